@@ -0,0 +1,186 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "image"
+    "log"
+    "os"
+    "path/filepath"
+    "runtime"
+    "time"
+
+    "github.com/JarwisMaster/go-check-color/palette"
+)
+
+// job carries the per-image settings shared by the batch runners.
+type job struct {
+    opts    palette.Options
+    timeout time.Duration
+    jsonOut bool
+    preview *previewFlags
+    strip   int
+    workers int // images processed at once; 0 means one per CPU
+    record  *manifestFlags
+}
+
+// result is one finished image of a batch; stdout holds what it printed.
+type result struct {
+    stdout bytes.Buffer
+    size   image.Point
+    pal    palette.Palette
+    dur    time.Duration
+    err    error
+}
+
+// checkWorkers validates -j against the other options.
+func checkWorkers(workers int, opts palette.Options) error {
+    if workers < 0 {
+        return usageError(errors.New("-j must be >= 0"))
+    }
+    if workers != 1 && opts.Progress != nil {
+        return usageError(errors.New("-progress needs -j 1"))
+    }
+    return nil
+}
+
+// runBatch composes every input into outputDir using up to j.workers goroutines.
+// Per-file log lines and stdout are emitted in input order, as a sequential run
+// would print them. Every file is attempted; the exit status is that of the first
+// failure.
+func runBatch(ctx context.Context, j job, inputs []input, outputDir string) error {
+    outPaths, err := outputPaths(inputs, outputDir)
+    if err != nil {
+        return err
+    }
+    previews, err := previewPaths(j.preview, inputs)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(outputDir, 0o755); err != nil {
+        return &cliError{Kind: errWrite, Path: outputDir, Err: err}
+    }
+    workers := j.workers
+    if workers == 0 {
+        workers = runtime.NumCPU()
+    }
+    record, err := openManifest(j.record, outputDir, workers)
+    if err != nil {
+        return err
+    }
+    if workers > len(inputs) {
+        workers = len(inputs)
+    }
+    if workers > 1 {
+        // Concurrent images share the CPUs rather than each fanning out over all of them.
+        j.opts.Limiter = palette.NewLimiter(0)
+    }
+
+    // 1) Workers take indices in order and close done[i] when input i is finished.
+    results := make([]result, len(inputs))
+    done := make([]chan struct{}, len(inputs))
+    for i := range done {
+        done[i] = make(chan struct{})
+    }
+    next := make(chan int)
+    go func() {
+        defer close(next)
+        for i := range inputs {
+            next <- i
+        }
+    }()
+    for w := 0; w < workers; w++ {
+        go func() {
+            for i := range next {
+                start := time.Now()
+                if err := inputs[i].err; err != nil {
+                    results[i].err = &cliError{Kind: errOpen, Path: inputs[i].path, Err: err}
+                } else {
+                    results[i].err = processImage(ctx, j, inputs[i].path, outPaths[i], previews[i], &results[i])
+                }
+                results[i].dur = time.Since(start)
+                close(done[i])
+            }
+        }()
+    }
+
+    // 2) Report in input order.
+    var firstErr error
+    for i, in := range inputs {
+        name := in.rel
+        log.Printf("%s: processing...", name)
+        <-done[i]
+        r := &results[i]
+        if _, err := r.stdout.WriteTo(os.Stdout); err != nil && r.err == nil {
+            r.err = &cliError{Kind: errWrite, Err: err}
+        }
+        if r.err != nil {
+            log.Printf("%s: error: %v", name, r.err)
+            if firstErr == nil {
+                firstErr = r.err
+            }
+        } else {
+            log.Printf("%s: done in %s", name, r.dur)
+        }
+        if err := record.add(newManifestFile(in, outPaths[i], previews[i], r)); err != nil && firstErr == nil {
+            firstErr = &cliError{Kind: errWrite, Path: j.record.path, Err: err}
+        }
+    }
+    if err := record.close(); err != nil && firstErr == nil {
+        firstErr = &cliError{Kind: errWrite, Path: j.record.path, Err: err}
+    }
+    return firstErr
+}
+
+// outputPaths names the composed PNG of every input and fails when two would share a
+// file, e.g. a.png and a.jpg in one directory.
+func outputPaths(inputs []input, outputDir string) ([]string, error) {
+    paths := make([]string, len(inputs))
+    seen := make(map[string]string, len(inputs))
+    for i, in := range inputs {
+        paths[i] = filepath.Join(outputDir, replaceExt(in.rel, ".png"))
+        if prev, ok := seen[paths[i]]; ok {
+            return nil, usageError(fmt.Errorf("%s and %s would both be written to %s; rename one or use -exclude", prev, in.path, paths[i]))
+        }
+        seen[paths[i]] = in.path
+    }
+    return paths, nil
+}
+
+// processImage: read, decode, build palette, optional JSON/preview, then write composed image.
+// JSON goes to r.stdout so concurrent images do not interleave; r also keeps the size and
+// palette for the manifest.
+func processImage(ctx context.Context, j job, inPath, outPath, previewPath string, r *result) error {
+    ctx, cancel := withTimeout(ctx, j.timeout)
+    defer cancel()
+    img, err := decodeFile(ctx, inPath)
+    if err != nil {
+        return err
+    }
+    r.size = img.Bounds().Size()
+    pal, err := extract(ctx, img, j.opts)
+    if err != nil {
+        return extractError(inPath, err)
+    }
+    r.pal = pal
+
+    if j.jsonOut {
+        if err := printJSON(&r.stdout, j.opts, pal); err != nil {
+            return &cliError{Kind: errWrite, Err: err}
+        }
+    }
+    if previewPath != "" {
+        if err := savePreview(previewPath, pal); err != nil {
+            return err
+        }
+    }
+    if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+        return &cliError{Kind: errWrite, Path: filepath.Dir(outPath), Err: err}
+    }
+    if err := saveComposite(outPath, img, pal, j.strip); err != nil {
+        return &cliError{Kind: errWrite, Path: outPath, Err: err}
+    }
+    return nil
+}
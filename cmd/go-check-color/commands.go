@@ -0,0 +1,271 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+
+    "github.com/JarwisMaster/go-check-color/palette"
+)
+
+// runExtract prints the palette of one image.
+func runExtract(ctx context.Context, args []string) error {
+    fs := newFlagSet("extract", "extract [flags] IMAGE", "Print the palette of IMAGE.")
+    formatName := fs.String("format", "text", "output format: text, json, gpl, hex, css")
+    preview := addPreviewFlags(fs)
+    engine := addEngineFlags(fs)
+    if err := parseFlags(fs, args); err != nil {
+        return err
+    }
+    if fs.NArg() != 1 {
+        return usageError(errors.New("extract takes exactly one image"))
+    }
+    opts, err := engine.options()
+    if err != nil {
+        return err
+    }
+    if err := preview.check(); err != nil {
+        return err
+    }
+    var format palette.Format
+    if *formatName != "text" {
+        if format, err = palette.ParseFormat(*formatName); err != nil {
+            return usageError(err)
+        }
+    }
+    inPath := fs.Arg(0)
+    ctx, cancel := withTimeout(ctx, engine.timeout)
+    defer cancel()
+    img, err := decodeFile(ctx, inPath)
+    if err != nil {
+        return err
+    }
+    pal, err := extract(ctx, img, opts)
+    if err != nil {
+        return extractError(inPath, err)
+    }
+
+    // text and json match the legacy -in output; the file formats carry the swatches only.
+    switch {
+    case *formatName == "text":
+        err = printText(os.Stdout, opts, pal)
+    case format == palette.FormatJSON:
+        err = printJSON(os.Stdout, opts, pal)
+    default:
+        err = palette.WritePalette(os.Stdout, pal.Entries(), format)
+    }
+    if err != nil {
+        return &cliError{Kind: errWrite, Err: err}
+    }
+
+    if previewPath := preview.path(input{path: inPath, rel: filepath.Base(inPath)}); previewPath != "" {
+        if err := savePreview(previewPath, pal); err != nil {
+            return err
+        }
+        fmt.Fprintf(os.Stderr, "palette preview saved: %s\n", previewPath)
+    }
+    return nil
+}
+
+// runCompose writes each input image with its palette strip into -out.
+func runCompose(ctx context.Context, args []string) error {
+    fs := newFlagSet("compose", "compose -out DIR [flags] IMAGE|DIR...",
+        "Write each image with its palette strip appended as DIR/<name>.png.\nDirectory arguments expand to the images directly inside them (the whole\ntree with -r, mirrored under DIR); -include/-exclude filter them.")
+    outputDir := fs.String("out", "", "output directory (required)")
+    stripWidth := fs.Int("strip", 80, "palette strip width in pixels")
+    workers := addJobsFlag(fs)
+    walk := addWalkFlags(fs)
+    record := addManifestFlags(fs)
+    preview := addPreviewFlags(fs)
+    engine := addEngineFlags(fs)
+    if err := parseFlags(fs, args); err != nil {
+        return err
+    }
+    if *outputDir == "" {
+        return usageError(errors.New("compose needs -out"))
+    }
+    if fs.NArg() == 0 {
+        return usageError(errors.New("compose needs at least one image or directory"))
+    }
+    opts, err := engine.options()
+    if err != nil {
+        return err
+    }
+    var inputs []input
+    for _, arg := range fs.Args() {
+        fi, err := os.Stat(arg)
+        if err != nil {
+            return &cliError{Kind: errOpen, Path: arg, Err: err}
+        }
+        if !fi.IsDir() {
+            inputs = append(inputs, input{path: arg, rel: filepath.Base(arg)})
+            continue
+        }
+        found, err := listImages(arg, walk)
+        if err != nil {
+            return err
+        }
+        inputs = append(inputs, found...)
+    }
+    if err := checkWorkers(*workers, opts); err != nil {
+        return err
+    }
+    if err := record.check(false); err != nil {
+        return err
+    }
+    if err := preview.check(); err != nil {
+        return err
+    }
+    j := job{opts: opts, timeout: engine.timeout, preview: preview, strip: *stripWidth, workers: *workers, record: record}
+    return runBatch(ctx, j, inputs, *outputDir)
+}
+
+// runCompare matches the swatches of two palettes; either side may be an image or a palette file.
+func runCompare(ctx context.Context, args []string) error {
+    fs := newFlagSet("compare", "compare [flags] A B",
+        "Match every swatch of A to the closest swatch of B by CIEDE2000.\nA and B are images or palette files (.json, .gpl, .hex, .txt);\nengine flags apply to images.")
+    jsonOutput := fs.Bool("json", false, "print the comparison as JSON")
+    engine := addEngineFlags(fs)
+    if err := parseFlags(fs, args); err != nil {
+        return err
+    }
+    if fs.NArg() != 2 {
+        return usageError(errors.New("compare takes exactly two palettes or images"))
+    }
+    opts, err := engine.options()
+    if err != nil {
+        return err
+    }
+    var sides [2][]palette.PaletteEntry
+    for i := range sides {
+        if sides[i], err = loadEntries(ctx, fs.Arg(i), engine, opts); err != nil {
+            return err
+        }
+    }
+    cmp := palette.ComparePalettes(sides[0], sides[1])
+
+    if *jsonOutput {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(cmp); err != nil {
+            return &cliError{Kind: errWrite, Err: err}
+        }
+        return nil
+    }
+    for _, m := range cmp.Matches {
+        fmt.Printf("%s\t%6.2f%%\t-> %s\tdeltaE=%.2f\n", m.From.Hex, m.From.Share*100, m.To.Hex, m.DeltaE)
+    }
+    fmt.Printf("mean deltaE=%.2f\tmax deltaE=%.2f\tunmatched in B: %d\n", cmp.MeanDeltaE, cmp.MaxDeltaE, len(cmp.Unmatched))
+    return nil
+}
+
+// loadEntries reads a palette file when the extension names a palette format and
+// extracts from the image otherwise.
+func loadEntries(ctx context.Context, path string, engine *engineFlags, opts palette.Options) ([]palette.PaletteEntry, error) {
+    if f, ok := palette.FormatForPath(path); ok {
+        return readPaletteFile(path, f)
+    }
+    ctx, cancel := withTimeout(ctx, engine.timeout)
+    defer cancel()
+    img, err := decodeFile(ctx, path)
+    if err != nil {
+        return nil, err
+    }
+    pal, err := extract(ctx, img, opts)
+    if err != nil {
+        return nil, extractError(path, err)
+    }
+    return pal.Entries(), nil
+}
+
+// readPaletteFile reads a palette file; "-" is stdin. CSS is output only, so naming
+// it as an input is a usage error rather than a decode failure.
+func readPaletteFile(path string, f palette.Format) ([]palette.PaletteEntry, error) {
+    if f == palette.FormatCSS {
+        return nil, usageError(fmt.Errorf("%s: css palettes cannot be read; use json, gpl or hex", path))
+    }
+    var r io.Reader = os.Stdin
+    if path != "-" {
+        file, err := os.Open(path)
+        if err != nil {
+            return nil, &cliError{Kind: errOpen, Path: path, Err: err}
+        }
+        defer file.Close()
+        r = file
+    }
+    entries, err := palette.ReadPalette(r, f)
+    if err != nil {
+        return nil, &cliError{Kind: errDecode, Path: path, Err: err}
+    }
+    return entries, nil
+}
+
+// runConvert rewrites a palette file in another format.
+func runConvert(ctx context.Context, args []string) error {
+    fs := newFlagSet("convert", "convert [flags] INPUT",
+        "Convert a palette file between json, gpl, hex and css (css is output only).\nINPUT may be - for stdin, in which case -from is required.")
+    fromName := fs.String("from", "", "input format: json, gpl, hex; default from the INPUT extension")
+    toName := fs.String("to", "", "output format: json, gpl, hex, css; default from the -o extension, else json")
+    outPath := fs.String("o", "", "output file; default stdout")
+    if err := parseFlags(fs, args); err != nil {
+        return err
+    }
+    if fs.NArg() != 1 {
+        return usageError(errors.New("convert takes exactly one input palette"))
+    }
+    inPath := fs.Arg(0)
+    from, err := pickFormat(*fromName, inPath)
+    if err != nil {
+        return err
+    }
+    to, err := pickFormat(*toName, *outPath)
+    if err != nil && *toName == "" {
+        to, err = palette.FormatJSON, nil
+    }
+    if err != nil {
+        return err
+    }
+    entries, err := readPaletteFile(inPath, from)
+    if err != nil {
+        return err
+    }
+
+    if *outPath == "" {
+        if err := palette.WritePalette(os.Stdout, entries, to); err != nil {
+            return &cliError{Kind: errWrite, Err: err}
+        }
+        return nil
+    }
+    file, err := os.Create(*outPath)
+    if err != nil {
+        return &cliError{Kind: errWrite, Path: *outPath, Err: err}
+    }
+    err = palette.WritePalette(file, entries, to)
+    // Close reports delayed write errors (NFS, full disk), so it is checked too.
+    if cerr := file.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return &cliError{Kind: errWrite, Path: *outPath, Err: err}
+    }
+    return nil
+}
+
+// pickFormat parses name, falling back to the extension of path when name is empty.
+func pickFormat(name, path string) (palette.Format, error) {
+    if name != "" {
+        f, err := palette.ParseFormat(name)
+        if err != nil {
+            return f, usageError(err)
+        }
+        return f, nil
+    }
+    if f, ok := palette.FormatForPath(path); ok {
+        return f, nil
+    }
+    return palette.FormatJSON, usageError(fmt.Errorf("cannot tell the palette format of %q; pass it explicitly", path))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "image"
+)
+
+// errorKind classifies a failure; each kind has its own exit status.
+type errorKind int
+
+const (
+    errInternal    errorKind = iota + 1 // 1: anything unclassified
+    errUsage                            // 2: bad flags or option combinations (same as the flag package)
+    errOpen                             // 3: input missing or unreadable
+    errDecode                           // 4: input is a known format but corrupt
+    errUnsupported                      // 5: input is not png/jpeg/gif
+    errExtract                          // 6: palette could not be built, e.g. -rect outside the image
+    errWrite                            // 7: output directory, file or stdout could not be written
+    errCanceled                         // 8: interrupted or -timeout expired
+)
+
+func (k errorKind) String() string {
+    switch k {
+    case errUsage:
+        return "usage"
+    case errOpen:
+        return "open"
+    case errDecode:
+        return "decode"
+    case errUnsupported:
+        return "unsupported format"
+    case errExtract:
+        return "extract"
+    case errWrite:
+        return "write"
+    case errCanceled:
+        return "canceled"
+    default:
+        return "internal"
+    }
+}
+
+// cliError is the error type behind every non-zero exit.
+type cliError struct {
+    Kind errorKind
+    Path string // file the failure concerns; empty when none
+    Err  error
+}
+
+func (e *cliError) Error() string {
+    if e.Path == "" {
+        return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+    }
+    return fmt.Sprintf("%s: %s: %v", e.Kind, e.Path, e.Err)
+}
+
+func (e *cliError) Unwrap() error { return e.Err }
+
+func usageError(err error) error {
+    return &cliError{Kind: errUsage, Err: err}
+}
+
+// decodeError separates unknown formats from corrupt files.
+func decodeError(path string, err error) error {
+    if errors.Is(err, image.ErrFormat) {
+        return &cliError{Kind: errUnsupported, Path: path, Err: err}
+    }
+    return &cliError{Kind: errDecode, Path: path, Err: err}
+}
+
+// extractError separates cancellation from extraction failures.
+func extractError(path string, err error) error {
+    if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+        return &cliError{Kind: errCanceled, Path: path, Err: err}
+    }
+    return &cliError{Kind: errExtract, Path: path, Err: err}
+}
+
+// exitCode maps err to the process exit status; nil is 0.
+func exitCode(err error) int {
+    if err == nil {
+        return 0
+    }
+    var ce *cliError
+    if errors.As(err, &ce) {
+        return int(ce.Kind)
+    }
+    return int(errInternal)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "time"
+
+    "github.com/JarwisMaster/go-check-color/palette"
+)
+
+// engineFlags are the palette engine settings every image-reading command accepts.
+type engineFlags struct {
+    colorSpec   string
+    autoMin     int
+    autoMax     int
+    pad         bool
+    mergeDeltaE float64
+    refill      bool
+    maxPixels   int
+    sampleName  string
+    fullCounts  bool
+    banded      bool
+    progress    bool
+    timeout     time.Duration
+    algo        string
+    spaceName   string
+    metricName  string
+    rectSpec    string
+    alphaName   string
+    alphaCutoff int
+    matteHex    string
+    excludeBg   bool
+    bgTolerance int
+    linear      bool
+    splitName   string
+    repName     string
+}
+
+// addEngineFlags registers the engine flags on fs.
+func addEngineFlags(fs *flag.FlagSet) *engineFlags {
+    def := palette.DefaultOptions()
+    e := &engineFlags{}
+    fs.StringVar(&e.colorSpec, "n", "8", "number of colors in the palette, or auto to pick it from the image")
+    fs.IntVar(&e.autoMin, "n-min", def.MinColors, "-n auto: smallest palette size considered")
+    fs.IntVar(&e.autoMax, "n-max", def.MaxColors, "-n auto: largest palette size considered")
+    fs.BoolVar(&e.pad, "pad", false, "repeat the last color until the palette has -n entries when the image has fewer distinct colors")
+    fs.Float64Var(&e.mergeDeltaE, "merge", 0, "merge palette entries closer than this CIEDE2000 distance (e.g. 2); 0 disables")
+    fs.BoolVar(&e.refill, "merge-refill", false, "-merge: re-split finer until the palette has -n distinct entries again")
+    fs.IntVar(&e.maxPixels, "max-pixels", 0, "downsample images larger than this many pixels before quantizing; 0 disables")
+    fs.StringVar(&e.sampleName, "sample", "area", "-max-pixels: downsampling: area (average), stride (pick)")
+    fs.BoolVar(&e.fullCounts, "full-counts", false, "-max-pixels: count shares on the full-resolution image")
+    fs.BoolVar(&e.banded, "banded", false, "histogram and count in row bands instead of copying every pixel; the decoded image is still held in memory (mediancut only)")
+    fs.BoolVar(&e.progress, "progress", false, "show a progress line on stderr")
+    fs.DurationVar(&e.timeout, "timeout", 0, "give up on decoding and extracting an image after this long (e.g. 30s); 0 waits forever")
+    fs.StringVar(&e.algo, "algo", "mediancut", "quantization algorithm: mediancut, kmeans, octree, wu")
+    fs.BoolVar(&e.linear, "linear", false, "average palette representatives in linear light (rgb space only)")
+    fs.StringVar(&e.splitName, "split", "range", "median cut: box to split next: range, population, range-population, variance")
+    fs.StringVar(&e.repName, "rep", "median", "median cut: box representative: median, mean, mode")
+    fs.StringVar(&e.spaceName, "space", "rgb", "color space for quantization: rgb, lab, oklab")
+    fs.StringVar(&e.rectSpec, "rect", "", "region of interest x,y,w,h; only its pixels are quantized")
+    fs.StringVar(&e.alphaName, "alpha", "ignore-transparent", "alpha policy: ignore-transparent, premultiply-over, weight-by-alpha, keep")
+    fs.IntVar(&e.alphaCutoff, "alpha-threshold", 0, "ignore-transparent: pixels with alpha <= threshold (0-255) are dropped")
+    fs.StringVar(&e.matteHex, "matte", "#FFFFFF", "premultiply-over: matte color translucent pixels are composited over")
+    fs.BoolVar(&e.excludeBg, "exclude-bg", false, "detect a uniform background from the image border and leave it out of the palette")
+    fs.IntVar(&e.bgTolerance, "bg-tolerance", def.BackgroundTolerance, "exclude-bg: max RGB distance from the detected background color")
+    fs.StringVar(&e.metricName, "metric", "euclidean", "distance for counting shares: euclidean (in -space), redmean, cie76, cie94, ciede2000")
+    return e
+}
+
+// options validates the parsed flags into engine options; failures are usage errors.
+func (e *engineFlags) options() (palette.Options, error) {
+    opts := palette.DefaultOptions()
+    colorCount, auto, err := parseColorCount(e.colorSpec)
+    if err != nil {
+        return opts, usageError(err)
+    }
+    space, err := palette.ParseColorSpace(e.spaceName)
+    if err != nil {
+        return opts, usageError(err)
+    }
+    qopts := palette.QuantizerOptions{Linear: e.linear}
+    if qopts.Split, err = palette.ParseSplitStrategy(e.splitName); err != nil {
+        return opts, usageError(err)
+    }
+    if qopts.Rep, err = palette.ParseRepresentative(e.repName); err != nil {
+        return opts, usageError(err)
+    }
+    if opts.Quantizer, err = palette.QuantizerByName(e.algo, qopts); err != nil {
+        return opts, usageError(err)
+    }
+    if opts.Metric, err = palette.ParseMetric(e.metricName); err != nil {
+        return opts, usageError(err)
+    }
+    opts.Space = space
+    opts.Colors = colorCount
+    opts.AutoColors = auto
+    opts.MinColors = e.autoMin
+    opts.MaxColors = e.autoMax
+    opts.Pad = e.pad
+    opts.MergeDeltaE = e.mergeDeltaE
+    opts.Refill = e.refill
+    opts.MaxPixels = e.maxPixels
+    opts.FullCounts = e.fullCounts
+    opts.Banded = e.banded
+    opts.ExcludeBackground = e.excludeBg
+    opts.BackgroundTolerance = e.bgTolerance
+    if opts.Sampling, err = palette.ParseSampleMode(e.sampleName); err != nil {
+        return opts, usageError(err)
+    }
+    if opts.Alpha.Mode, err = palette.ParseAlphaMode(e.alphaName); err != nil {
+        return opts, usageError(err)
+    }
+    if e.alphaCutoff < 0 || e.alphaCutoff > 255 {
+        return opts, usageError(errors.New("alpha threshold must be within 0..255"))
+    }
+    opts.Alpha.Threshold = uint8(e.alphaCutoff)
+    if opts.Alpha.Matte, err = palette.ParseHex(e.matteHex); err != nil {
+        return opts, usageError(err)
+    }
+    if e.rectSpec != "" {
+        if opts.Rect, err = palette.ParseRect(e.rectSpec); err != nil {
+            return opts, usageError(err)
+        }
+    }
+    if err := opts.Validate(); err != nil {
+        return opts, usageError(err)
+    }
+    if e.progress {
+        opts.Progress = progressLine()
+    }
+    return opts, nil
+}
+
+// addJobsFlag registers -j on a batch command.
+func addJobsFlag(fs *flag.FlagSet) *int {
+    return fs.Int("j", 1, "batch: images processed concurrently; 0 means one per CPU")
+}
+
+// newFlagSet returns a flag set whose parse errors come back to run instead of exiting.
+func newFlagSet(name, synopsis, about string) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ContinueOnError)
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "usage: go-check-color %s\n\n%s\n\nflags:\n", synopsis, about)
+        fs.PrintDefaults()
+    }
+    return fs
+}
+
+// parseFlags parses args; -h surfaces as flag.ErrHelp, which main treats as success.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+    if err := fs.Parse(args); err != nil {
+        return usageError(err)
+    }
+    return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "image"
+    "image/png"
+    _ "image/gif"
+    _ "image/jpeg"
+    _ "image/png"
+    "io"
+    "log"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/JarwisMaster/go-check-color/palette"
+)
+
+// Minimal CLI wrapper: dispatches subcommands (or the original flat flag set) and
+// delegates to palette package. Failures exit with the status of their errorKind
+// (see errors.go and the README).
+func main() {
+    if err := run(os.Args[1:]); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            return
+        }
+        log.Print(err)
+        os.Exit(exitCode(err))
+    }
+}
+
+// commands maps subcommand names to their entry points.
+var commands = map[string]func(ctx context.Context, args []string) error{
+    "extract": runExtract,
+    "compose": runCompose,
+    "compare": runCompare,
+    "convert": runConvert,
+}
+
+const commandSummary = `commands:
+  extract   print the palette of one image (text, json, gpl, hex, css)
+  compose   write images with the palette strip appended
+  compare   match two palettes (images or palette files) by CIEDE2000
+  convert   convert palette files between json, gpl, hex and css
+
+Run "go-check-color <command> -h" for a command's flags. Without a command the
+original flags below are accepted unchanged.`
+
+// run dispatches to a subcommand; anything else goes through runLegacy so existing
+// scripts keep working.
+func run(args []string) error {
+    // Ctrl-C cancels the image in flight instead of killing the process mid-write.
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    if len(args) > 0 {
+        if cmd, ok := commands[args[0]]; ok {
+            return cmd(ctx, args[1:])
+        }
+    }
+    return runLegacy(ctx, args)
+}
+
+// runLegacy is the original single-file/batch interface: -in prints a palette (and
+// composes into -out when set); -IN with -out composes a whole directory.
+func runLegacy(ctx context.Context, args []string) error {
+    var (
+        inputFile   string
+        jsonOutput  bool
+        inputDir    string
+        outputDir   string
+        stripWidth  int
+    )
+    fs := newFlagSet("go-check-color", "[command] [flags]", commandSummary)
+    fs.StringVar(&inputFile, "in", "", "input image path (png/jpg/gif)")
+    fs.BoolVar(&jsonOutput, "json", false, "print palette as JSON")
+    fs.StringVar(&inputDir, "IN", "", "input directory for batch processing")
+    fs.StringVar(&outputDir, "out", "", "output directory for batch results")
+    fs.IntVar(&stripWidth, "strip", 80, "palette strip width in pixels")
+    workers := addJobsFlag(fs)
+    walk := addWalkFlags(fs)
+    record := addManifestFlags(fs)
+    preview := addPreviewFlags(fs)
+    engine := addEngineFlags(fs)
+    if err := parseFlags(fs, args); err != nil {
+        return err
+    }
+    opts, err := engine.options()
+    if err != nil {
+        return err
+    }
+    j := job{opts: opts, timeout: engine.timeout, jsonOut: jsonOutput, preview: preview, strip: stripWidth, workers: *workers, record: record}
+    if err := checkWorkers(j.workers, opts); err != nil {
+        return err
+    }
+    if err := record.check(jsonOutput); err != nil {
+        return err
+    }
+    if err := preview.check(); err != nil {
+        return err
+    }
+
+    // Batch mode: iterate files in inputDir, write composed PNGs to outputDir.
+    if inputDir != "" && outputDir != "" {
+        inputs, err := listImages(inputDir, walk)
+        if err != nil {
+            return err
+        }
+        return runBatch(ctx, j, inputs, outputDir)
+    }
+
+    if inputFile == "" {
+        return usageError(errors.New("provide input path via -in or use batch mode -IN/-out"))
+    }
+
+    ctx, cancel := withTimeout(ctx, j.timeout)
+    defer cancel()
+    img, err := decodeFile(ctx, inputFile)
+    if err != nil {
+        return err
+    }
+
+    pal, err := extract(ctx, img, opts)
+    if err != nil {
+        return extractError(inputFile, err)
+    }
+
+    if jsonOutput {
+        err = printJSON(os.Stdout, opts, pal)
+    } else {
+        err = printText(os.Stdout, opts, pal)
+    }
+    if err != nil {
+        return &cliError{Kind: errWrite, Err: err}
+    }
+
+    if previewPath := preview.path(input{path: inputFile, rel: filepath.Base(inputFile)}); previewPath != "" {
+        if err := savePreview(previewPath, pal); err != nil {
+            return err
+        }
+        fmt.Printf("palette preview saved: %s\n", previewPath)
+    }
+
+    // If user wants composite output of single file, save into outputDir
+    if outputDir != "" {
+        if err := os.MkdirAll(outputDir, 0o755); err != nil {
+            return &cliError{Kind: errWrite, Path: outputDir, Err: err}
+        }
+        base := replaceExt(filepath.Base(inputFile), ".png")
+        outPath := filepath.Join(outputDir, base)
+        if err := saveComposite(outPath, img, pal, stripWidth); err != nil {
+            return &cliError{Kind: errWrite, Path: outPath, Err: err}
+        }
+    }
+    return nil
+}
+
+// printText writes the hex lines, after the background line when exclude-bg is set.
+func printText(w io.Writer, opts palette.Options, pal palette.Palette) error {
+    if opts.ExcludeBackground {
+        if err := palette.WriteBackgroundText(w, pal.Background); err != nil {
+            return err
+        }
+    }
+    return palette.WritePalette(w, pal.Entries(), palette.FormatHex)
+}
+
+// printJSON keeps the bare entry array unless exclude-bg asks for the background too.
+func printJSON(w io.Writer, opts palette.Options, pal palette.Palette) error {
+    if opts.ExcludeBackground {
+        return palette.WritePaletteJSONWithBackground(w, pal.Entries(), pal.Background)
+    }
+    return palette.WritePalette(w, pal.Entries(), palette.FormatJSON)
+}
+
+// withTimeout bounds the decode and extraction of one image; 0 means no limit.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+    if timeout > 0 {
+        return context.WithTimeout(ctx, timeout)
+    }
+    return context.WithCancel(ctx)
+}
+
+// decodeFile opens and decodes one image, classifying failures as open, decode,
+// unsupported or canceled.
+func decodeFile(ctx context.Context, path string) (image.Image, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, &cliError{Kind: errOpen, Path: path, Err: err}
+    }
+    defer f.Close()
+    img, _, err := image.Decode(contextReader{ctx: ctx, r: f})
+    if err != nil {
+        if ctx.Err() != nil {
+            return nil, &cliError{Kind: errCanceled, Path: path, Err: ctx.Err()}
+        }
+        return nil, decodeError(path, err)
+    }
+    return img, nil
+}
+
+// contextReader fails every read once ctx is done, so a decoder gives up at its next read.
+type contextReader struct {
+    ctx context.Context
+    r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+    if err := r.ctx.Err(); err != nil {
+        return 0, err
+    }
+    return r.r.Read(p)
+}
+
+// extract runs palette.ExtractContext, ending the progress line when there is one.
+func extract(ctx context.Context, img image.Image, opts palette.Options) (palette.Palette, error) {
+    pal, err := palette.ExtractContext(ctx, img, opts)
+    if opts.Progress != nil {
+        fmt.Fprintln(os.Stderr)
+    }
+    return pal, err
+}
+
+// progressLine redraws one stderr line per whole percent or phase change.
+func progressLine() palette.ProgressFunc {
+    var last palette.Phase
+    lastPct := -1
+    return func(phase palette.Phase, fraction float64) {
+        pct := int(fraction * 100)
+        if phase == last && pct == lastPct {
+            return
+        }
+        last, lastPct = phase, pct
+        fmt.Fprintf(os.Stderr, "\r%-8s %3d%%", phase, pct)
+    }
+}
+
+// saveComposite writes PNG with the original content and palette strip appended on the right.
+func saveComposite(path string, img image.Image, pal palette.Palette, stripWidth int) error {
+    composed := palette.ComposeWithPaletteStrip(img, pal.Colors, pal.Counts, stripWidth)
+    outFile, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer outFile.Close()
+    return png.Encode(outFile, composed)
+}
+
+// parseColorCount reads -n: a positive count, or "auto".
+func parseColorCount(s string) (int, bool, error) {
+    if strings.EqualFold(s, "auto") {
+        return 0, true, nil
+    }
+    n, err := strconv.Atoi(s)
+    if err != nil || n <= 0 {
+        return 0, false, fmt.Errorf("number of colors must be > 0 or auto, got %q", s)
+    }
+    return n, false, nil
+}
+
+// replaceExt normalizes output filenames to PNG while preserving the base name.
+func replaceExt(name, newExt string) string {
+    base := strings.TrimSuffix(name, filepath.Ext(name))
+    if !strings.HasPrefix(newExt, ".") {
+        newExt = "." + newExt
+    }
+    return base + newExt
+}
+
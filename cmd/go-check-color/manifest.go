@@ -0,0 +1,184 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/JarwisMaster/go-check-color/palette"
+)
+
+// manifestFlags select where and how runBatch records its results.
+type manifestFlags struct {
+    path   string
+    format string
+}
+
+// addManifestFlags registers -manifest and -manifest-format on a batch command.
+func addManifestFlags(fs *flag.FlagSet) *manifestFlags {
+    m := &manifestFlags{}
+    fs.StringVar(&m.path, "manifest", "", "batch: write per-file results and a run summary to this file (- for stdout)")
+    fs.StringVar(&m.format, "manifest-format", "", "batch: manifest format: json, jsonl; default jsonl for .jsonl/.ndjson paths, else json")
+    return m
+}
+
+// lines reports whether the manifest is JSON Lines.
+func (m *manifestFlags) lines() (bool, error) {
+    switch strings.ToLower(m.format) {
+    case "json":
+        return false, nil
+    case "jsonl", "ndjson":
+        return true, nil
+    case "":
+        ext := strings.ToLower(filepath.Ext(m.path))
+        return ext == ".jsonl" || ext == ".ndjson", nil
+    default:
+        return false, fmt.Errorf("unknown manifest format %q", m.format)
+    }
+}
+
+// check validates the flags; a manifest on stdout cannot share it with -json.
+func (m *manifestFlags) check(jsonOut bool) error {
+    if _, err := m.lines(); err != nil {
+        return usageError(err)
+    }
+    if m.path == "-" && jsonOut {
+        return usageError(errors.New("-manifest - and -json both write to stdout"))
+    }
+    return nil
+}
+
+// manifestFile is the record of one batch input.
+type manifestFile struct {
+    Path       string                 `json:"path"`
+    Output     string                 `json:"output,omitempty"`
+    Preview    string                 `json:"preview,omitempty"`
+    Width      int                    `json:"width,omitempty"`
+    Height     int                    `json:"height,omitempty"`
+    Palette    []palette.PaletteEntry `json:"palette,omitempty"` // most frequent first
+    Background *palette.Background    `json:"background,omitempty"`
+    DurationMS float64                `json:"duration_ms"`
+    Error      string                 `json:"error,omitempty"`
+    ErrorKind  string                 `json:"error_kind,omitempty"` // see Exit codes in the README
+}
+
+// manifestSummary closes a manifest.
+type manifestSummary struct {
+    Started    time.Time `json:"started"`
+    DurationMS float64   `json:"duration_ms"`
+    OutputDir  string    `json:"output_dir"`
+    Workers    int       `json:"workers"`
+    Files      int       `json:"files"`
+    Succeeded  int       `json:"succeeded"`
+    Failed     int       `json:"failed"`
+}
+
+// manifest writes JSON Lines as files finish, or one JSON document on close.
+type manifest struct {
+    w       io.Writer
+    f       *os.File // nil for stdout
+    lines   bool
+    files   []manifestFile
+    summary manifestSummary
+}
+
+// openManifest creates the manifest file; a nil manifest records nothing.
+func openManifest(m *manifestFlags, outputDir string, workers int) (*manifest, error) {
+    if m == nil || m.path == "" {
+        return nil, nil
+    }
+    lines, err := m.lines()
+    if err != nil {
+        return nil, usageError(err)
+    }
+    mf := &manifest{w: os.Stdout, lines: lines}
+    if m.path != "-" {
+        if mf.f, err = os.Create(m.path); err != nil {
+            return nil, &cliError{Kind: errWrite, Path: m.path, Err: err}
+        }
+        mf.w = mf.f
+    }
+    mf.summary = manifestSummary{Started: time.Now(), OutputDir: outputDir, Workers: workers}
+    return mf, nil
+}
+
+// add records one finished input.
+func (m *manifest) add(rec manifestFile) error {
+    if m == nil {
+        return nil
+    }
+    m.summary.Files++
+    if rec.Error == "" {
+        m.summary.Succeeded++
+    } else {
+        m.summary.Failed++
+    }
+    if !m.lines {
+        m.files = append(m.files, rec)
+        return nil
+    }
+    return json.NewEncoder(m.w).Encode(rec)
+}
+
+// close writes the summary (a final {"summary": ...} line for JSON Lines) and the
+// collected files for JSON.
+func (m *manifest) close() error {
+    if m == nil {
+        return nil
+    }
+    m.summary.DurationMS = milliseconds(time.Since(m.summary.Started))
+    var err error
+    if m.lines {
+        err = json.NewEncoder(m.w).Encode(struct {
+            Summary manifestSummary `json:"summary"`
+        }{m.summary})
+    } else {
+        enc := json.NewEncoder(m.w)
+        enc.SetIndent("", "  ")
+        files := m.files
+        if files == nil {
+            files = []manifestFile{}
+        }
+        err = enc.Encode(struct {
+            Summary manifestSummary `json:"summary"`
+            Files   []manifestFile  `json:"files"`
+        }{m.summary, files})
+    }
+    if m.f != nil {
+        if cerr := m.f.Close(); err == nil {
+            err = cerr
+        }
+    }
+    return err
+}
+
+// newManifestFile describes a finished input for the manifest.
+func newManifestFile(in input, outPath, previewPath string, r *result) manifestFile {
+    rec := manifestFile{Path: in.path, DurationMS: milliseconds(r.dur)}
+    if r.err != nil {
+        rec.Error = r.err.Error()
+        var ce *cliError
+        if errors.As(r.err, &ce) {
+            rec.ErrorKind = ce.Kind.String()
+        } else {
+            rec.ErrorKind = errInternal.String()
+        }
+        return rec
+    }
+    rec.Output = outPath
+    rec.Preview = previewPath
+    rec.Width, rec.Height = r.size.X, r.size.Y
+    rec.Palette = r.pal.Entries()
+    rec.Background = r.pal.Background
+    return rec
+}
+
+func milliseconds(d time.Duration) float64 {
+    return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+
+    "github.com/JarwisMaster/go-check-color/palette"
+)
+
+// previewFlags name the palette preview PNG of each image.
+type previewFlags struct {
+    template string
+    dir      string
+}
+
+// addPreviewFlags registers -preview and -preview-dir on fs.
+func addPreviewFlags(fs *flag.FlagSet) *previewFlags {
+    p := &previewFlags{}
+    fs.StringVar(&p.template, "preview", "", "path to save palette preview (PNG); may use {dir}, {name}, {ext}, {rel}, e.g. {dir}/{name}.palette.png")
+    fs.StringVar(&p.dir, "preview-dir", "", "save palette previews under this directory (as {rel}.palette.png unless -preview is set)")
+    return p
+}
+
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// check rejects unknown placeholders.
+func (p *previewFlags) check() error {
+    for _, ph := range placeholder.FindAllString(p.template, -1) {
+        switch ph {
+        case "{dir}", "{name}", "{ext}", "{rel}":
+        default:
+            return usageError(fmt.Errorf("-preview: unknown placeholder %s (want {dir}, {name}, {ext} or {rel})", ph))
+        }
+    }
+    return nil
+}
+
+// path returns the preview path of in, or "" when previews are off. {dir} is the
+// input's directory, {name} its file name without extension, {ext} the extension
+// without the dot and {rel} the path below the batch directory without extension.
+func (p *previewFlags) path(in input) string {
+    if p == nil || p.template == "" && p.dir == "" {
+        return ""
+    }
+    template := p.template
+    if template == "" {
+        template = "{rel}.palette.png"
+    }
+    base := filepath.Base(in.path)
+    ext := filepath.Ext(base)
+    r := strings.NewReplacer(
+        "{dir}", filepath.Dir(in.path),
+        "{name}", strings.TrimSuffix(base, ext),
+        "{ext}", strings.TrimPrefix(ext, "."),
+        "{rel}", strings.TrimSuffix(in.rel, filepath.Ext(in.rel)),
+    )
+    out := r.Replace(template)
+    if p.dir != "" && !filepath.IsAbs(out) {
+        out = filepath.Join(p.dir, out)
+    }
+    return filepath.Clean(out)
+}
+
+// previewPaths names the preview of every input and fails when two would share a file.
+func previewPaths(p *previewFlags, inputs []input) ([]string, error) {
+    paths := make([]string, len(inputs))
+    seen := make(map[string]string, len(inputs))
+    for i, in := range inputs {
+        paths[i] = p.path(in)
+        if paths[i] == "" {
+            continue
+        }
+        if prev, ok := seen[paths[i]]; ok {
+            return nil, usageError(fmt.Errorf("previews of %s and %s would both be written to %s; use a -preview template such as {dir}/{name}.palette.png or -preview-dir", prev, in.path, paths[i]))
+        }
+        seen[paths[i]] = in.path
+    }
+    return paths, nil
+}
+
+// savePreview writes the palette preview, creating its directory.
+func savePreview(path string, pal palette.Palette) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return &cliError{Kind: errWrite, Path: filepath.Dir(path), Err: err}
+    }
+    if err := palette.SavePalettePreview(path, pal.Colors, pal.Counts); err != nil {
+        return &cliError{Kind: errWrite, Path: path, Err: err}
+    }
+    return nil
+}
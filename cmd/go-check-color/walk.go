@@ -0,0 +1,154 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// input is one image of a batch; rel is where its output goes below -out.
+type input struct {
+    path string
+    rel  string
+    err  error // set when the file could not be read while listing
+}
+
+// walkFlags select the images of a batch directory.
+type walkFlags struct {
+    recursive bool
+    include   patternList
+    exclude   patternList
+}
+
+// patternList is a repeatable glob flag.
+type patternList []string
+
+func (p *patternList) String() string { return strings.Join(*p, ",") }
+
+func (p *patternList) Set(v string) error {
+    if _, err := path.Match(v, ""); err != nil {
+        return fmt.Errorf("bad pattern %q: %v", v, err)
+    }
+    *p = append(*p, v)
+    return nil
+}
+
+// addWalkFlags registers the batch directory flags on fs.
+func addWalkFlags(fs *flag.FlagSet) *walkFlags {
+    w := &walkFlags{}
+    fs.BoolVar(&w.recursive, "r", false, "batch: descend into subdirectories and mirror them under -out")
+    fs.Var(&w.include, "include", "batch: only process files matching this glob (repeatable); patterns with / match the path below the input directory, others the file name")
+    fs.Var(&w.exclude, "exclude", "batch: skip files and directories matching this glob (repeatable)")
+    return w
+}
+
+// matchAny reports whether a pattern matches rel, a slash path below the batch root.
+func matchAny(patterns []string, rel string) bool {
+    for _, p := range patterns {
+        target := path.Base(rel)
+        if strings.Contains(p, "/") {
+            target = rel
+        }
+        if ok, _ := path.Match(p, target); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// listImages returns the images below dir in walk (name) order: its direct files, or
+// the whole tree with -r. Files are kept by content, not extension; only regular
+// files (or symlinks to them) are considered. Unreadable entries below dir are
+// returned with err set so the batch reports them per file.
+func listImages(dir string, w *walkFlags) ([]input, error) {
+    var inputs []input
+    err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+        if p == dir {
+            return err
+        }
+        rel, rerr := filepath.Rel(dir, p)
+        if rerr != nil {
+            return rerr
+        }
+        if err != nil {
+            inputs = append(inputs, input{path: p, rel: rel, err: err})
+            if d != nil && d.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        slash := filepath.ToSlash(rel)
+        if d.IsDir() {
+            if !w.recursive || matchAny(w.exclude, slash) {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        if len(w.include) > 0 && !matchAny(w.include, slash) || matchAny(w.exclude, slash) {
+            return nil
+        }
+        if !d.Type().IsRegular() {
+            // Symlinks count when they lead to a regular file; directories they lead
+            // to are not followed.
+            if d.Type()&fs.ModeSymlink == 0 {
+                return nil
+            }
+            fi, err := os.Stat(p)
+            if err != nil {
+                inputs = append(inputs, input{path: p, rel: rel, err: err})
+                return nil
+            }
+            if !fi.Mode().IsRegular() {
+                return nil
+            }
+        }
+        ok, err := sniffImage(p)
+        if err != nil {
+            inputs = append(inputs, input{path: p, rel: rel, err: err})
+            return nil
+        }
+        if ok {
+            inputs = append(inputs, input{path: p, rel: rel})
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, &cliError{Kind: errOpen, Path: dir, Err: err}
+    }
+    return inputs, nil
+}
+
+// magics are the leading bytes of the formats registered by the blank imports in main.go.
+var magics = [][]byte{
+    []byte("\x89PNG\r\n\x1a\n"),
+    []byte("\xff\xd8\xff"),
+    []byte("GIF87a"),
+    []byte("GIF89a"),
+}
+
+// sniffImage reports whether the file at p starts like a PNG, JPEG or GIF.
+func sniffImage(p string) (bool, error) {
+    f, err := os.Open(p)
+    if err != nil {
+        return false, err
+    }
+    defer f.Close()
+    head := make([]byte, 8)
+    n, err := io.ReadFull(f, head)
+    if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+        return false, err
+    }
+    for _, m := range magics {
+        if bytes.HasPrefix(head[:n], m) {
+            return true, nil
+        }
+    }
+    return false, nil
+}
@@ -1,3 +1,3 @@
-module go-check-color
+module github.com/JarwisMaster/go-check-color
 
 go 1.18
@@ -0,0 +1,201 @@
+package palette
+
+import (
+    "fmt"
+    "image"
+    "strings"
+)
+
+// AlphaMode decides what translucent pixels contribute to the palette.
+type AlphaMode int
+
+const (
+    AlphaKeep              AlphaMode = iota // discard alpha, keep stored color (legacy behaviour)
+    AlphaIgnoreTransparent                  // drop pixels with alpha <= Threshold
+    AlphaPremultiplyOver                    // composite every pixel over Matte
+    AlphaWeight                             // weight every pixel by its alpha
+)
+
+// AlphaPolicy configures CollectPixelsAlpha.
+type AlphaPolicy struct {
+    Mode      AlphaMode
+    Threshold uint8 // AlphaIgnoreTransparent: highest alpha still treated as transparent
+    Matte     RGB   // AlphaPremultiplyOver: background color under translucent pixels
+}
+
+// ParseAlphaMode maps the -alpha flag value to an AlphaMode.
+func ParseAlphaMode(name string) (AlphaMode, error) {
+    switch strings.ToLower(name) {
+    case "keep":
+        return AlphaKeep, nil
+    case "", "ignore-transparent":
+        return AlphaIgnoreTransparent, nil
+    case "premultiply-over", "matte":
+        return AlphaPremultiplyOver, nil
+    case "weight-by-alpha", "weight":
+        return AlphaWeight, nil
+    default:
+        return AlphaKeep, fmt.Errorf("unknown alpha mode %q", name)
+    }
+}
+
+// CollectPixelsAlpha collects pixels under policy. Weights are returned only for
+// AlphaWeight (one alpha value per kept pixel) and are nil otherwise; fully
+// transparent pixels carry no weight and are dropped in that mode.
+// Opaque-only image types go straight to CollectPixels.
+func CollectPixelsAlpha(img image.Image, policy AlphaPolicy) ([]RGB, []uint8) {
+    return CollectPixelsExcluding(img, policy, nil)
+}
+
+// CollectPixelsExcluding is CollectPixelsAlpha that also skips every pixel whose
+// row-major position within img.Bounds() is set in exclude (nil excludes nothing).
+func CollectPixelsExcluding(img image.Image, policy AlphaPolicy, exclude []bool) ([]RGB, []uint8) {
+    if policy.Mode == AlphaKeep {
+        return dropExcluded(CollectPixels(img), exclude), nil
+    }
+    switch img.(type) {
+    case *image.YCbCr, *image.Gray, *image.Gray16:
+        return dropExcluded(CollectPixels(img), exclude), nil
+    }
+    b := img.Bounds()
+    c := alphaCollector{policy: policy, exclude: exclude, pixels: make([]RGB, 0, b.Dx()*b.Dy())}
+    if policy.Mode == AlphaWeight {
+        c.weights = make([]uint8, 0, b.Dx()*b.Dy())
+    }
+
+    switch src := img.(type) {
+    case *image.NRGBA:
+        // 1) Fast path: straight (non-premultiplied) color.
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < b.Dx(); x++ {
+                off := x * 4
+                c.add(row[off], row[off+1], row[off+2], row[off+3])
+            }
+        }
+    case *image.RGBA:
+        // 2) Fast path: premultiplied, un-premultiply before applying the policy.
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < b.Dx(); x++ {
+                off := x * 4
+                c.addPremultiplied(row[off], row[off+1], row[off+2], row[off+3])
+            }
+        }
+    case *image.Paletted:
+        // 3) Fast path: resolve color and alpha per palette index once, as At would.
+        var lut [256][4]uint8 // premultiplied; indices past the palette stay transparent
+        for j, pc := range src.Palette {
+            if j == len(lut) {
+                break
+            }
+            r, g, bb, a := pc.RGBA()
+            lut[j] = [4]uint8{uint8(r >> 8), uint8(g >> 8), uint8(bb >> 8), uint8(a >> 8)}
+        }
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < b.Dx(); x++ {
+                e := &lut[row[x]]
+                c.addPremultiplied(e[0], e[1], e[2], e[3])
+            }
+        }
+    case *image.RGBA64:
+        // 4) Fast path: premultiplied big-endian 16-bit, high bytes.
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < b.Dx(); x++ {
+                off := x * 8
+                c.addPremultiplied(row[off], row[off+2], row[off+4], row[off+6])
+            }
+        }
+    case *image.NRGBA64:
+        // 5) Fast path: straight 16-bit color, high bytes.
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < b.Dx(); x++ {
+                off := x * 8
+                c.add(row[off], row[off+2], row[off+4], row[off+6])
+            }
+        }
+    default:
+        // 6) Generic path: RGBA() is premultiplied 16-bit.
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            for x := b.Min.X; x < b.Max.X; x++ {
+                r, g, bb, a := img.At(x, y).RGBA()
+                c.addPremultiplied(uint8(r>>8), uint8(g>>8), uint8(bb>>8), uint8(a>>8))
+            }
+        }
+    }
+    return c.pixels, c.weights
+}
+
+type alphaCollector struct {
+    policy  AlphaPolicy
+    exclude []bool
+    pos     int // row-major position of the next pixel, for exclude
+    pixels  []RGB
+    weights []uint8
+}
+
+// add takes a straight-alpha color.
+func (c *alphaCollector) add(r, g, b, a uint8) {
+    if c.exclude != nil {
+        skip := c.exclude[c.pos]
+        c.pos++
+        if skip {
+            return
+        }
+    }
+    switch c.policy.Mode {
+    case AlphaIgnoreTransparent:
+        if a <= c.policy.Threshold {
+            return
+        }
+        c.pixels = append(c.pixels, RGB{r, g, b})
+    case AlphaPremultiplyOver:
+        m := c.policy.Matte
+        c.pixels = append(c.pixels, RGB{over(r, m.R, a), over(g, m.G, a), over(b, m.B, a)})
+    case AlphaWeight:
+        if a == 0 {
+            return
+        }
+        c.pixels = append(c.pixels, RGB{r, g, b})
+        c.weights = append(c.weights, a)
+    }
+}
+
+// addPremultiplied takes a premultiplied color.
+func (c *alphaCollector) addPremultiplied(r, g, b, a uint8) {
+    if a == 0 || a == 255 {
+        c.add(r, g, b, a)
+        return
+    }
+    c.add(unpremultiply(r, a), unpremultiply(g, a), unpremultiply(b, a), a)
+}
+
+// dropExcluded filters a full row-major pixel grid in place.
+func dropExcluded(pixels []RGB, exclude []bool) []RGB {
+    if exclude == nil {
+        return pixels
+    }
+    kept := pixels[:0]
+    for i, p := range pixels {
+        if !exclude[i] {
+            kept = append(kept, p)
+        }
+    }
+    return kept
+}
+
+func unpremultiply(v, a uint8) uint8 {
+    u := (int(v)*255 + int(a)/2) / int(a)
+    if u > 255 {
+        u = 255
+    }
+    return uint8(u)
+}
+
+// over blends straight color v with alpha a on top of matte m.
+func over(v, m, a uint8) uint8 {
+    return uint8((int(v)*int(a) + int(m)*(255-int(a)) + 127) / 255)
+}
@@ -0,0 +1,133 @@
+package palette
+
+import (
+    "context"
+    "math"
+)
+
+// Default search range for -n auto.
+const (
+    defaultAutoMin = 2
+    defaultAutoMax = 16
+)
+
+// autoSearchPixels caps the pixels each candidate size is quantized on when the
+// quantizer cannot cut from the histogram.
+const autoSearchPixels = 1 << 17
+
+// AutoPalette tries every size in [minK, maxK], picks the one at the elbow of the
+// quantization error curve (the point farthest below the chord from the first to
+// the last size, with both axes normalized: the "kneedle" rule) and quantizes
+// pixels once at that size. Error is measured over the 5-bit histogram; median cut
+// candidates are cut from it directly and other quantizers try the sizes on a
+// sample of at most autoSearchPixels pixels.
+func AutoPalette(q Quantizer, pixels []RGB, weights []uint8, minK, maxK int) []RGB {
+    h := histogramFor(q)
+    h.AddWeighted(pixels, weights)
+    bins := h.Bins()
+    search := autoSearch(context.Background(), q, bins, pixels, weights)
+    k, _ := autoSize(bins, minK, maxK, search, func(float64) {})
+    if _, ok := q.(MedianCut); ok {
+        palette, _ := search(k)
+        return palette
+    }
+    return quantizeWeighted(q, pixels, weights, k)
+}
+
+// autoSearch returns the quantize function autoSize tries each size with: median
+// cut over a copy of bins (what it would build from pixels anyway), or q on a
+// stride sample of the pixels.
+func autoSearch(ctx context.Context, q Quantizer, bins []histBin, pixels []RGB, weights []uint8) func(k int) ([]RGB, error) {
+    if mc, ok := q.(MedianCut); ok {
+        return func(k int) ([]RGB, error) {
+            if err := ctx.Err(); err != nil {
+                return nil, err
+            }
+            if len(pixels) <= k {
+                return medianCutPalette(ctx, pixels, weights, k, mc, func(float64) {})
+            }
+            // medianCutBins reorders bins in place; every cut starts from histogram order.
+            return medianCutBins(append([]histBin(nil), bins...), k, mc), nil
+        }
+    }
+    pixels, weights = strideSample(pixels, weights, autoSearchPixels)
+    return func(k int) ([]RGB, error) {
+        return quantizeContext(ctx, q, pixels, weights, k, func(float64) {})
+    }
+}
+
+// strideSample keeps every n-th pixel (and weight) so that at most max remain.
+func strideSample(pixels []RGB, weights []uint8, max int) ([]RGB, []uint8) {
+    if len(pixels) <= max {
+        return pixels, weights
+    }
+    step := (len(pixels) + max - 1) / max
+    sp := make([]RGB, 0, max)
+    var sw []uint8
+    if weights != nil {
+        sw = make([]uint8, 0, max)
+    }
+    for i := 0; i < len(pixels); i += step {
+        sp = append(sp, pixels[i])
+        if weights != nil {
+            sw = append(sw, weights[i])
+        }
+    }
+    return sp, sw
+}
+
+// autoSize returns the palette size at the elbow over histogram bins; quantize
+// returns the candidate palette of size k or a cancellation error.
+func autoSize(bins []histBin, minK, maxK int, quantize func(k int) ([]RGB, error), report func(float64)) (int, error) {
+    if minK < 1 {
+        minK = 1
+    }
+    if maxK < minK {
+        maxK = minK
+    }
+    // 1) Error curve; stop early once the quantizer runs out of colors.
+    var errs []float64
+    for k := minK; k <= maxK; k++ {
+        palette, err := quantize(k)
+        if err != nil {
+            return 0, err
+        }
+        report(float64(k-minK+1) / float64(maxK-minK+1))
+        errs = append(errs, quantizationError(bins, palette))
+        if len(palette) < k || errs[len(errs)-1] == 0 {
+            break
+        }
+    }
+    last := len(errs) - 1
+    if last == 0 || errs[0] <= errs[last] {
+        return minK + last, nil
+    }
+
+    // 2) Elbow: largest gap between the chord and the normalized curve.
+    best, bestGap := last, 0.0
+    span := errs[0] - errs[last]
+    for i := 1; i < last; i++ {
+        x := float64(i) / float64(last)
+        y := (errs[i] - errs[last]) / span
+        if gap := (1 - x) - y; gap > bestGap {
+            bestGap = gap
+            best = i
+        }
+    }
+    return minK + best, nil
+}
+
+// quantizationError: population-weighted squared distance from each bin's mean to
+// its nearest palette color. Within-bin spread is the same for every palette and is left out.
+func quantizationError(bins []histBin, palette []RGB) float64 {
+    if len(palette) == 0 {
+        return math.Inf(1)
+    }
+    nearest := MetricEuclidean.nearestFunc(palette)
+    var sum float64
+    for _, b := range bins {
+        d := colorDistanceSqInt(b.C, palette[nearest(b.C)])
+        sum += float64(b.N) * float64(d)
+    }
+    return sum
+}
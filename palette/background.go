@@ -0,0 +1,148 @@
+package palette
+
+import (
+    "encoding/json"
+    "fmt"
+    "image"
+    "io"
+    "os"
+)
+
+// Background is the backdrop found by DetectBackground.
+type Background struct {
+    Color RGB     `json:"color"`
+    Count int     `json:"count"`
+    Share float64 `json:"share"` // of all pixels in the analysed region
+    Hex   string  `json:"hex"`
+}
+
+// bgBorderMajority: the dominant border color must cover at least this share of the
+// frame, otherwise the image is treated as having no uniform background.
+const bgBorderMajority = 0.5
+
+// DetectBackground estimates the backdrop color from the 1-pixel image frame and
+// flood-fills (4-connected) from the frame through pixels within tolerance of it.
+// The returned mask marks background pixels in row-major order over img.Bounds();
+// both results are nil when the border has no dominant color.
+func DetectBackground(img image.Image, tolerance int) (*Background, []bool) {
+    b := img.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if w == 0 || h == 0 {
+        return nil, nil
+    }
+    grid := CollectPixels(img)
+
+    // 1) Sample the frame and pick its most populated histogram cell.
+    border := make([]int, 0, 2*(w+h))
+    for x := 0; x < w; x++ {
+        border = append(border, x, (h-1)*w+x)
+    }
+    for y := 1; y < h-1; y++ {
+        border = append(border, y*w, y*w+w-1)
+    }
+    var cellCount [histSize]int
+    best := 0
+    for _, i := range border {
+        c := histIndex(grid[i])
+        cellCount[c]++
+        if cellCount[c] > cellCount[best] {
+            best = c
+        }
+    }
+    if float64(cellCount[best]) < bgBorderMajority*float64(len(border)) {
+        return nil, nil
+    }
+    var sumR, sumG, sumB int64
+    for _, i := range border {
+        if p := grid[i]; histIndex(p) == best {
+            sumR += int64(p.R)
+            sumG += int64(p.G)
+            sumB += int64(p.B)
+        }
+    }
+    n := int64(cellCount[best])
+    seed := RGB{uint8((sumR + n/2) / n), uint8((sumG + n/2) / n), uint8((sumB + n/2) / n)}
+
+    // 2) Flood fill from matching frame pixels.
+    tol := tolerance * tolerance
+    mask := make([]bool, len(grid))
+    queue := make([]int32, 0, len(border))
+    push := func(i int) {
+        if !mask[i] && colorDistanceSqInt(grid[i], seed) <= tol {
+            mask[i] = true
+            queue = append(queue, int32(i))
+        }
+    }
+    for _, i := range border {
+        push(i)
+    }
+    sumR, sumG, sumB = 0, 0, 0
+    count := 0
+    for len(queue) > 0 {
+        i := int(queue[len(queue)-1])
+        queue = queue[:len(queue)-1]
+        p := grid[i]
+        sumR += int64(p.R)
+        sumG += int64(p.G)
+        sumB += int64(p.B)
+        count++
+        x, y := i%w, i/w
+        if x > 0 {
+            push(i - 1)
+        }
+        if x < w-1 {
+            push(i + 1)
+        }
+        if y > 0 {
+            push(i - w)
+        }
+        if y < h-1 {
+            push(i + w)
+        }
+    }
+    if count == 0 {
+        return nil, nil
+    }
+    c := RGB{
+        uint8((sumR + int64(count)/2) / int64(count)),
+        uint8((sumG + int64(count)/2) / int64(count)),
+        uint8((sumB + int64(count)/2) / int64(count)),
+    }
+    return &Background{
+        Color: c,
+        Count: count,
+        Share: float64(count) / float64(len(grid)),
+        Hex:   toHex(c),
+    }, mask
+}
+
+// PrintBackgroundText prints the detected background on its own line ahead of the palette.
+func PrintBackgroundText(bg *Background) {
+    WriteBackgroundText(os.Stdout, bg)
+}
+
+// WriteBackgroundText is PrintBackgroundText for any writer.
+func WriteBackgroundText(w io.Writer, bg *Background) error {
+    if bg == nil {
+        _, err := fmt.Fprintln(w, "background\tnone")
+        return err
+    }
+    _, err := fmt.Fprintf(w, "background\t%s\tcount=%d\tshare=%.2f%%\n", bg.Hex, bg.Count, bg.Share*100)
+    return err
+}
+
+// PrintPaletteJSONWithBackground wraps the palette entries in an object that also
+// carries the excluded background (null when none was detected).
+func PrintPaletteJSONWithBackground(palette []RGB, counts []int, bg *Background) error {
+    return WritePaletteJSONWithBackground(os.Stdout, makeEntries(palette, counts), bg)
+}
+
+// WritePaletteJSONWithBackground is PrintPaletteJSONWithBackground for any writer.
+func WritePaletteJSONWithBackground(w io.Writer, entries []PaletteEntry, bg *Background) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    return enc.Encode(struct {
+        Background *Background     `json:"background"`
+        Palette    []PaletteEntry `json:"palette"`
+    }{bg, entries})
+}
@@ -0,0 +1,112 @@
+package palette
+
+import (
+    "context"
+    "fmt"
+    "image"
+)
+
+// bandPixels bounds how many collected pixels the banded path holds at once.
+const bandPixels = 1 << 20
+
+// bandSource walks an image in full-width row bands. Only one band's pixels
+// exist at a time; the palette is cut from an accumulated histogram and shares
+// are counted band by band.
+type bandSource struct {
+    img   image.Image
+    alpha AlphaPolicy
+    space ColorSpace
+}
+
+// bands calls fn with the collected pixels of each band, top to bottom.
+func (s bandSource) bands(ctx context.Context, report func(float64), fn func(pixels []RGB, weights []uint8)) error {
+    return forEachBand(ctx, s.img, s.alpha, nil, report, fn)
+}
+
+func (s bandSource) countShares(ctx context.Context, palette []RGB, metric Metric, work bool, report func(float64)) ([]int, error) {
+    counts := make([]int, len(palette))
+    if len(palette) == 0 {
+        return counts, nil
+    }
+    nearest := metric.nearestFunc(palette)
+    weighted := false
+    err := s.bands(ctx, report, func(pixels []RGB, weights []uint8) {
+        if work {
+            pixels = s.space.Encode(pixels)
+        }
+        for i, n := range countNearest(limiterFrom(ctx), pixels, weights, len(palette), nearest) {
+            counts[i] += n
+        }
+        weighted = weighted || weights != nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    if weighted {
+        for i := range counts {
+            counts[i] = (counts[i] + 127) / 255
+        }
+    }
+    return counts, nil
+}
+
+func (s bandSource) decode(ctx context.Context, raw []RGB, space ColorSpace) ([]RGB, error) {
+    if space == SpaceRGB {
+        return raw, nil
+    }
+    m := newCodeMeans(space, raw)
+    err := s.bands(ctx, func(float64) {}, func(pixels []RGB, weights []uint8) {
+        m.add(pixels, space.Encode(pixels), weights)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return m.palette(), nil
+}
+
+// buildBanded is collect+build without materializing the pixel slice: one band
+// pass fills the histogram, median cut runs on its bins, further passes count
+// shares. Memory beyond the decoded image is one band plus the 32768-cell
+// histogram; the decoded image itself is still held in full. Median cut only,
+// since the other quantizers need every pixel; Validate also rules out
+// ExcludeBackground, whose flood fill needs a full-image grid, and RepMode, whose
+// exact counts grow with the number of distinct colors.
+func (o Options) buildBanded(ctx context.Context, img image.Image) ([]RGB, []int, *Background, error) {
+    mc, ok := o.Quantizer.(MedianCut)
+    if !ok {
+        return nil, nil, nil, fmt.Errorf("banded processing supports the mediancut algorithm only")
+    }
+    if !o.Rect.Empty() {
+        cropped, err := CropImage(img, o.Rect)
+        if err != nil {
+            return nil, nil, nil, err
+        }
+        img = cropped
+    }
+    src := bandSource{img: img, alpha: o.Alpha, space: o.Space}
+
+    // 1) Accumulate the working-space histogram band by band.
+    h := histogramFor(mc)
+    err := src.bands(ctx, o.Progress.phase(PhaseCollect), func(pixels []RGB, weights []uint8) {
+        h.AddWeighted(o.Space.Encode(pixels), weights)
+    })
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    bins := h.Bins()
+    quantize := func(k int) ([]RGB, error) {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        // medianCutBins reorders bins in place; every cut starts from histogram order.
+        return medianCutBins(append([]histBin(nil), bins...), k, mc), nil
+    }
+
+    // 2) Cut the palette from the bins, then count, merge and pad over bands.
+    raw, err := o.quantizeAll(bins, quantize, quantize)
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    palette, counts, err := o.finish(ctx, src, raw, quantize)
+    return palette, counts, nil, err
+}
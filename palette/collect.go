@@ -0,0 +1,186 @@
+package palette
+
+import (
+    "fmt"
+    "image"
+    "image/color"
+    "strconv"
+    "strings"
+)
+
+// CollectPixels: fast paths for the concrete types the stdlib decoders return
+// (RGBA/NRGBA for PNG, YCbCr for JPEG, Paletted for GIF, Gray*, *64); fallback to
+// generic At(). Avoids RGBA() per-pixel cost. Every path honours Bounds().Min,
+// so sub-images yield exactly their own region.
+func CollectPixels(img image.Image) []RGB {
+    b := img.Bounds()
+    width, height := b.Dx(), b.Dy()
+    n := width * height
+    pixels := make([]RGB, n)
+
+    switch src := img.(type) {
+    case *image.RGBA:
+        // 1) Fast path: tight loop over backing Pix for RGBA.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            start := src.PixOffset(b.Min.X, y)
+            row := src.Pix[start : start+width*4]
+            for x := 0; x < width; x++ {
+                off := x * 4
+                pixels[i] = RGB{row[off], row[off+1], row[off+2]}
+                i++
+            }
+        }
+        return pixels
+    case *image.NRGBA:
+        // 2) Fast path: same idea for NRGBA.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            start := src.PixOffset(b.Min.X, y)
+            row := src.Pix[start : start+width*4]
+            for x := 0; x < width; x++ {
+                off := x * 4
+                pixels[i] = RGB{row[off], row[off+1], row[off+2]}
+                i++
+            }
+        }
+        return pixels
+    case *image.YCbCr:
+        // 3) JPEG: convert planes directly; COffset covers every subsample ratio.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            yi := src.YOffset(b.Min.X, y)
+            for x := b.Min.X; x < b.Max.X; x++ {
+                ci := src.COffset(x, y)
+                r, g, bb := color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+                pixels[i] = RGB{r, g, bb}
+                yi++
+                i++
+            }
+        }
+        return pixels
+    case *image.Paletted:
+        // 4) GIF: resolve the palette once, then index per pixel.
+        var lut [256]RGB
+        for j, c := range src.Palette {
+            if j == len(lut) {
+                break
+            }
+            r, g, bb, _ := c.RGBA()
+            lut[j] = RGB{uint8(r >> 8), uint8(g >> 8), uint8(bb >> 8)}
+        }
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < width; x++ {
+                pixels[i] = lut[row[x]]
+                i++
+            }
+        }
+        return pixels
+    case *image.Gray:
+        // 5) Gray: one byte per pixel.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < width; x++ {
+                v := row[x]
+                pixels[i] = RGB{v, v, v}
+                i++
+            }
+        }
+        return pixels
+    case *image.Gray16:
+        // 6) Gray16: big-endian, keep the high byte.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < width; x++ {
+                v := row[x*2]
+                pixels[i] = RGB{v, v, v}
+                i++
+            }
+        }
+        return pixels
+    case *image.RGBA64:
+        // 7) RGBA64: 8 bytes per pixel, high byte of each channel.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < width; x++ {
+                off := x * 8
+                pixels[i] = RGB{row[off], row[off+2], row[off+4]}
+                i++
+            }
+        }
+        return pixels
+    case *image.NRGBA64:
+        // 8) NRGBA64: same layout as RGBA64, non-premultiplied like NRGBA.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            row := src.Pix[src.PixOffset(b.Min.X, y):]
+            for x := 0; x < width; x++ {
+                off := x * 8
+                pixels[i] = RGB{row[off], row[off+2], row[off+4]}
+                i++
+            }
+        }
+        return pixels
+    default:
+        // 9) Generic path: use At()/RGBA() when memory layout is unknown.
+        i := 0
+        for y := b.Min.Y; y < b.Max.Y; y++ {
+            for x := b.Min.X; x < b.Max.X; x++ {
+                r, g, bb, _ := img.At(x, y).RGBA()
+                pixels[i] = RGB{uint8(r >> 8), uint8(g >> 8), uint8(bb >> 8)}
+                i++
+            }
+        }
+        return pixels
+    }
+}
+
+// ParseRect parses the -rect flag value "x,y,w,h" into a rectangle at (x, y).
+func ParseRect(s string) (image.Rectangle, error) {
+    parts := strings.Split(s, ",")
+    if len(parts) != 4 {
+        return image.Rectangle{}, fmt.Errorf("rect %q: want x,y,w,h", s)
+    }
+    var v [4]int
+    for i, p := range parts {
+        n, err := strconv.Atoi(strings.TrimSpace(p))
+        if err != nil {
+            return image.Rectangle{}, fmt.Errorf("rect %q: %v", s, err)
+        }
+        v[i] = n
+    }
+    if v[2] <= 0 || v[3] <= 0 {
+        return image.Rectangle{}, fmt.Errorf("rect %q: width and height must be > 0", s)
+    }
+    return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// CropImage returns the region r of img, with r relative to the top-left corner of
+// img's bounds. The region is clipped to the image; an empty result is an error.
+// The pixel data is shared, not copied.
+func CropImage(img image.Image, r image.Rectangle) (image.Image, error) {
+    b := img.Bounds()
+    region := r.Add(b.Min).Intersect(b)
+    if region.Empty() {
+        return nil, fmt.Errorf("rect %v lies outside image bounds %v", r, b)
+    }
+    if sub, ok := img.(interface {
+        SubImage(image.Rectangle) image.Image
+    }); ok {
+        return sub.SubImage(region), nil
+    }
+    return croppedImage{img, region}, nil
+}
+
+// croppedImage narrows Bounds() for image types without SubImage.
+type croppedImage struct {
+    image.Image
+    rect image.Rectangle
+}
+
+func (c croppedImage) Bounds() image.Rectangle { return c.rect }
@@ -0,0 +1,313 @@
+package palette
+
+import (
+    "fmt"
+    "math"
+    "strings"
+)
+
+// ColorSpace selects where boxes are cut and representatives averaged.
+// Non-RGB spaces are packed into RGB byte triples (see Encode), so every quantizer
+// and colorDistanceSqInt run unchanged on converted pixels.
+type ColorSpace int
+
+const (
+    SpaceRGB ColorSpace = iota
+    SpaceLab
+    SpaceOKLab
+)
+
+// ParseColorSpace maps the -space flag value to a ColorSpace.
+func ParseColorSpace(name string) (ColorSpace, error) {
+    switch strings.ToLower(name) {
+    case "", "rgb", "srgb":
+        return SpaceRGB, nil
+    case "lab", "cielab":
+        return SpaceLab, nil
+    case "oklab":
+        return SpaceOKLab, nil
+    default:
+        return SpaceRGB, fmt.Errorf("unknown color space %q", name)
+    }
+}
+
+func (s ColorSpace) String() string {
+    switch s {
+    case SpaceLab:
+        return "lab"
+    case SpaceOKLab:
+        return "oklab"
+    default:
+        return "rgb"
+    }
+}
+
+// Packing scales are uniform across channels so squared byte distance stays
+// proportional to Euclidean distance in the space (ΔE76 for Lab). One byte step is
+// well under a just-noticeable difference, but near the gamut edges it spans up to
+// ~28 sRGB units, so palettes are decoded through codeMeans rather than Decode.
+const (
+    labScale   = 1.0   // L 0..100, a/b offset by 128
+    oklabScale = 255.0 // L 0..255, a/b offset by 128
+)
+
+// Encode converts pixels into s once. For SpaceRGB the input slice is returned as is.
+func (s ColorSpace) Encode(pixels []RGB) []RGB {
+    if s == SpaceRGB {
+        return pixels
+    }
+    out := make([]RGB, len(pixels))
+    for i, p := range pixels {
+        out[i] = s.encode(p)
+    }
+    return out
+}
+
+// Decode converts packed colors from s back to sRGB.
+func (s ColorSpace) Decode(colors []RGB) []RGB {
+    if s == SpaceRGB {
+        return colors
+    }
+    out := make([]RGB, len(colors))
+    for i, c := range colors {
+        out[i] = s.decode(c)
+    }
+    return out
+}
+
+func (s ColorSpace) encode(c RGB) RGB {
+    switch s {
+    case SpaceLab:
+        l, a, b := toLab(c)
+        return RGB{clampByte(l * labScale), clampByte(a*labScale + 128), clampByte(b*labScale + 128)}
+    case SpaceOKLab:
+        l, a, b := toOKLab(c)
+        return RGB{clampByte(l * oklabScale), clampByte(a*oklabScale + 128), clampByte(b*oklabScale + 128)}
+    default:
+        return c
+    }
+}
+
+func (s ColorSpace) decode(c RGB) RGB {
+    switch s {
+    case SpaceLab:
+        return fromLab(float64(c.R)/labScale, (float64(c.G)-128)/labScale, (float64(c.B)-128)/labScale)
+    case SpaceOKLab:
+        return fromOKLab(float64(c.R)/oklabScale, (float64(c.G)-128)/oklabScale, (float64(c.B)-128)/oklabScale)
+    default:
+        return c
+    }
+}
+
+// toFloat converts an sRGB color to unpacked coordinates in s.
+func (s ColorSpace) toFloat(c RGB) (x, y, z float64) {
+    switch s {
+    case SpaceLab:
+        return toLab(c)
+    case SpaceOKLab:
+        return toOKLab(c)
+    default:
+        return float64(c.R), float64(c.G), float64(c.B)
+    }
+}
+
+// fromFloat is the inverse of toFloat.
+func (s ColorSpace) fromFloat(x, y, z float64) RGB {
+    switch s {
+    case SpaceLab:
+        return fromLab(x, y, z)
+    case SpaceOKLab:
+        return fromOKLab(x, y, z)
+    default:
+        return RGB{clampByte(x), clampByte(y), clampByte(z)}
+    }
+}
+
+// codeMeans decodes a working-space palette from the pixels behind it: each code
+// becomes the float mean, in the space, of the pixels encoded to exactly that code.
+// A color that survives quantization unchanged thus comes back as it was; codes no
+// pixel was encoded to (e.g. averaged representatives) fall back to Decode.
+type codeMeans struct {
+    space ColorSpace
+    raw   []RGB
+    index map[RGB]int
+    sums  [][4]float64 // x, y, z, total weight
+}
+
+func newCodeMeans(space ColorSpace, raw []RGB) *codeMeans {
+    m := &codeMeans{space: space, raw: raw, index: make(map[RGB]int, len(raw)), sums: make([][4]float64, len(raw))}
+    for i, c := range raw {
+        if _, ok := m.index[c]; !ok {
+            m.index[c] = i
+        }
+    }
+    return m
+}
+
+// add accumulates sRGB pixels and their working-space codes (nil weights = uniform).
+func (m *codeMeans) add(pixels, work []RGB, weights []uint8) {
+    for i, code := range work {
+        j, ok := m.index[code]
+        if !ok {
+            continue
+        }
+        w := 1.0
+        if weights != nil {
+            w = float64(weights[i])
+        }
+        x, y, z := m.space.toFloat(pixels[i])
+        s := &m.sums[j]
+        s[0] += x * w
+        s[1] += y * w
+        s[2] += z * w
+        s[3] += w
+    }
+}
+
+// palette returns the decoded colors in raw order.
+func (m *codeMeans) palette() []RGB {
+    out := make([]RGB, len(m.raw))
+    for i, c := range m.raw {
+        s := m.sums[m.index[c]]
+        if s[3] == 0 {
+            out[i] = m.space.decode(c)
+            continue
+        }
+        out[i] = m.space.fromFloat(s[0]/s[3], s[1]/s[3], s[2]/s[3])
+    }
+    return out
+}
+
+// srgbToLinearLUT: sRGB transfer decode for every byte value.
+var srgbToLinearLUT = func() [256]float64 {
+    var t [256]float64
+    for i := range t {
+        v := float64(i) / 255
+        if v <= 0.04045 {
+            t[i] = v / 12.92
+        } else {
+            t[i] = math.Pow((v+0.055)/1.055, 2.4)
+        }
+    }
+    return t
+}()
+
+// linearSum accumulates weighted channel totals in linear light, for averaging
+// representatives without the darkening of averaging gamma-encoded bytes.
+type linearSum struct {
+    r, g, b float64
+}
+
+func (s *linearSum) add(p RGB, w int) {
+    fw := float64(w)
+    s.r += srgbToLinearLUT[p.R] * fw
+    s.g += srgbToLinearLUT[p.G] * fw
+    s.b += srgbToLinearLUT[p.B] * fw
+}
+
+func (s *linearSum) merge(o linearSum) {
+    s.r += o.r
+    s.g += o.g
+    s.b += o.b
+}
+
+// mean re-encodes the average of n accumulated units to sRGB.
+func (s linearSum) mean(n int) RGB {
+    if n <= 0 {
+        return RGB{0, 0, 0}
+    }
+    fn := float64(n)
+    return RGB{linearToSRGB(s.r / fn), linearToSRGB(s.g / fn), linearToSRGB(s.b / fn)}
+}
+
+// linearMid averages two encoded values in linear light.
+func linearMid(a, b uint8) uint8 {
+    return linearToSRGB((srgbToLinearLUT[a] + srgbToLinearLUT[b]) / 2)
+}
+
+func linearToSRGB(v float64) uint8 {
+    if v <= 0.0031308 {
+        v *= 12.92
+    } else {
+        v = 1.055*math.Pow(v, 1/2.4) - 0.055
+    }
+    return clampByte(v * 255)
+}
+
+func clampByte(v float64) uint8 {
+    if v <= 0 {
+        return 0
+    }
+    if v >= 255 {
+        return 255
+    }
+    return uint8(math.Round(v))
+}
+
+// D65 reference white.
+const (
+    whiteX = 0.95047
+    whiteY = 1.0
+    whiteZ = 1.08883
+)
+
+func labF(t float64) float64 {
+    if t > 216.0/24389 {
+        return math.Cbrt(t)
+    }
+    return (24389.0/27*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+    if t3 := t * t * t; t3 > 216.0/24389 {
+        return t3
+    }
+    return (116*t - 16) * 27 / 24389
+}
+
+// toLab converts sRGB to CIELAB (D65).
+func toLab(c RGB) (l, a, b float64) {
+    r, g, bl := srgbToLinearLUT[c.R], srgbToLinearLUT[c.G], srgbToLinearLUT[c.B]
+    x := (0.4124564*r + 0.3575761*g + 0.1804375*bl) / whiteX
+    y := (0.2126729*r + 0.7151522*g + 0.0721750*bl) / whiteY
+    z := (0.0193339*r + 0.1191920*g + 0.9503041*bl) / whiteZ
+    fx, fy, fz := labF(x), labF(y), labF(z)
+    return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func fromLab(l, a, b float64) RGB {
+    fy := (l + 16) / 116
+    fx := fy + a/500
+    fz := fy - b/200
+    x := labFInv(fx) * whiteX
+    y := labFInv(fy) * whiteY
+    z := labFInv(fz) * whiteZ
+    return RGB{
+        linearToSRGB(3.2404542*x - 1.5371385*y - 0.4985314*z),
+        linearToSRGB(-0.9692660*x + 1.8760108*y + 0.0415560*z),
+        linearToSRGB(0.0556434*x - 0.2040259*y + 1.0572252*z),
+    }
+}
+
+// toOKLab converts sRGB to OKLab (Björn Ottosson, 2020).
+func toOKLab(c RGB) (l, a, b float64) {
+    r, g, bl := srgbToLinearLUT[c.R], srgbToLinearLUT[c.G], srgbToLinearLUT[c.B]
+    lc := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*bl)
+    mc := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*bl)
+    sc := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*bl)
+    return 0.2104542553*lc + 0.7936177850*mc - 0.0040720468*sc,
+        1.9779984951*lc - 2.4285922050*mc + 0.4505937099*sc,
+        0.0259040371*lc + 0.7827717662*mc - 0.8086757660*sc
+}
+
+func fromOKLab(l, a, b float64) RGB {
+    lc := l + 0.3963377774*a + 0.2158037573*b
+    mc := l - 0.1055613458*a - 0.0638541728*b
+    sc := l - 0.0894841775*a - 1.2914855480*b
+    lc, mc, sc = lc*lc*lc, mc*mc*mc, sc*sc*sc
+    return RGB{
+        linearToSRGB(4.0767416621*lc - 3.3077115913*mc + 0.2309699292*sc),
+        linearToSRGB(-1.2684380046*lc + 2.6097574011*mc - 0.3413193965*sc),
+        linearToSRGB(-0.0041960863*lc - 0.7034186147*mc + 1.7076147010*sc),
+    }
+}
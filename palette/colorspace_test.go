@@ -0,0 +1,82 @@
+package palette
+
+import (
+    "image"
+    "image/color"
+    "testing"
+)
+
+// TestCodeMeansRoundTrip walks the sRGB cube: a color that is its own palette entry
+// must decode back unchanged from Lab and OKLab, gamut edges included.
+func TestCodeMeansRoundTrip(t *testing.T) {
+    for _, space := range []ColorSpace{SpaceLab, SpaceOKLab} {
+        worst := 0
+        for r := 0; r < 256; r += 5 {
+            for g := 0; g < 256; g += 5 {
+                for b := 0; b < 256; b += 5 {
+                    p := []RGB{{uint8(r), uint8(g), uint8(b)}}
+                    work := space.Encode(p)
+                    m := newCodeMeans(space, work)
+                    m.add(p, work, nil)
+                    if got := m.palette()[0]; got != p[0] {
+                        t.Fatalf("%v: %v decodes to %v", space, p[0], got)
+                    }
+                    if d := maxChannelDiff(p[0], space.Decode(work)[0]); d > worst {
+                        worst = d
+                    }
+                }
+            }
+        }
+        t.Logf("%v: byte packing alone is off by up to %d", space, worst)
+    }
+}
+
+// TestExtractKeepsColorsInLab checks the end-to-end promise: an image with no more
+// colors than requested keeps its exact colors under every color space.
+func TestExtractKeepsColorsInLab(t *testing.T) {
+    colors := []RGB{{0, 233, 248}, {29, 254, 182}, {255, 0, 0}, {0, 0, 255}, {255, 0, 255}, {0, 255, 0}, {10, 10, 10}, {250, 250, 245}}
+    img := image.NewRGBA(image.Rect(0, 0, len(colors)*10, 10))
+    for y := 0; y < 10; y++ {
+        for x := 0; x < len(colors)*10; x++ {
+            c := colors[x/10]
+            img.Set(x, y, color.RGBA{c.R, c.G, c.B, 255})
+        }
+    }
+    for _, space := range []ColorSpace{SpaceRGB, SpaceLab, SpaceOKLab} {
+        for _, banded := range []bool{false, true} {
+            opts := DefaultOptions()
+            opts.Space = space
+            opts.Banded = banded
+            pal, err := Extract(img, opts)
+            if err != nil {
+                t.Fatal(err)
+            }
+            want := make(map[RGB]bool)
+            for _, c := range colors {
+                want[c] = true
+            }
+            for _, c := range pal.Colors {
+                if !want[c] {
+                    t.Errorf("%v banded=%v: swatch %v is not an image color", space, banded, c)
+                }
+                delete(want, c)
+            }
+            if len(want) != 0 {
+                t.Errorf("%v banded=%v: missing %v", space, banded, want)
+            }
+        }
+    }
+}
+
+func maxChannelDiff(a, b RGB) int {
+    d := 0
+    for _, x := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B)} {
+        if x < 0 {
+            x = -x
+        }
+        if x > d {
+            d = x
+        }
+    }
+    return d
+}
@@ -0,0 +1,63 @@
+package palette
+
+import "math"
+
+// Match pairs a swatch of one palette with the closest swatch of another.
+type Match struct {
+    From   PaletteEntry `json:"from"`
+    To     PaletteEntry `json:"to"`
+    DeltaE float64      `json:"delta_e"` // CIEDE2000
+}
+
+// Comparison is the result of ComparePalettes.
+type Comparison struct {
+    Matches    []Match `json:"matches"`      // one per swatch of a, in a's order
+    Unmatched  []int   `json:"unmatched_b"`  // indices of b that are no swatch's closest match
+    MeanDeltaE float64 `json:"mean_delta_e"` // share-weighted over Matches (plain mean without shares)
+    MaxDeltaE  float64 `json:"max_delta_e"`
+}
+
+// ComparePalettes matches every swatch of a to its nearest swatch of b by CIEDE2000.
+func ComparePalettes(a, b []PaletteEntry) Comparison {
+    var cmp Comparison
+    if len(a) == 0 || len(b) == 0 {
+        return cmp
+    }
+    labs := make([]lab, len(b))
+    for i, e := range b {
+        labs[i] = newLab(e.Color)
+    }
+    used := make([]bool, len(b))
+    totalShare := 0.0
+    for _, e := range a {
+        totalShare += e.Share
+    }
+    sum := 0.0
+    for _, e := range a {
+        p := newLab(e.Color)
+        best, bestD := 0, ciede2000DistanceSq(p, labs[0])
+        for j := 1; j < len(labs); j++ {
+            if d := ciede2000DistanceSq(p, labs[j]); d < bestD {
+                best, bestD = j, d
+            }
+        }
+        used[best] = true
+        de := math.Sqrt(math.Max(bestD, 0))
+        cmp.Matches = append(cmp.Matches, Match{From: e, To: b[best], DeltaE: de})
+        if totalShare > 0 {
+            sum += de * e.Share / totalShare
+        } else {
+            sum += de / float64(len(a))
+        }
+        if de > cmp.MaxDeltaE {
+            cmp.MaxDeltaE = de
+        }
+    }
+    cmp.MeanDeltaE = sum
+    for j, ok := range used {
+        if !ok {
+            cmp.Unmatched = append(cmp.Unmatched, j)
+        }
+    }
+    return cmp
+}
@@ -0,0 +1,370 @@
+package palette
+
+import (
+    "context"
+    "fmt"
+    "image"
+)
+
+// Options configures Extract. Start from DefaultOptions; the zero value is not usable
+// because Colors must be set.
+type Options struct {
+    Quantizer           Quantizer  // nil means MedianCut{}
+    Space               ColorSpace // where boxes are cut and colors averaged
+    Metric              Metric     // distance for counting shares
+    Colors              int        // palette size, unless AutoColors
+    AutoColors          bool       // pick the size within MinColors..MaxColors instead of using Colors
+    MinColors           int
+    MaxColors           int
+    Pad                 bool            // repeat colors up to Colors when the image has fewer distinct ones
+    MergeDeltaE         float64         // fold swatches closer than this CIEDE2000 distance; 0 disables
+    Refill              bool            // after merging, re-split until Colors distinct swatches remain
+    MaxPixels           int             // downsample above this many pixels; 0 keeps full resolution
+    Sampling            SampleMode      // how MaxPixels downsamples
+    FullCounts          bool            // count shares on the full-resolution pixels after downsampling
+    Banded              bool            // histogram and count in row bands instead of one pixel slice; the decoded image stays in memory
+    Rect                image.Rectangle // region of interest relative to Bounds().Min; empty means the whole image
+    Alpha               AlphaPolicy
+    ExcludeBackground   bool // detect a border-connected backdrop and leave it out
+    BackgroundTolerance int  // max RGB distance from the detected background color
+    Progress            ProgressFunc // optional; called as each phase advances
+    Limiter             *Limiter     // optional; shared by concurrent extractions to split the CPUs
+}
+
+// DefaultOptions matches the CLI defaults: 8 colors, median cut in RGB, Euclidean
+// shares, transparent pixels ignored.
+func DefaultOptions() Options {
+    return Options{
+        Quantizer:           MedianCut{},
+        Colors:              8,
+        MinColors:           defaultAutoMin,
+        MaxColors:           defaultAutoMax,
+        Alpha:               AlphaPolicy{Mode: AlphaIgnoreTransparent, Matte: RGB{255, 255, 255}},
+        BackgroundTolerance: 24,
+    }
+}
+
+// Validate reports option combinations Extract cannot run.
+func (o Options) Validate() error {
+    if o.AutoColors {
+        if o.MinColors <= 0 || o.MaxColors < o.MinColors {
+            return fmt.Errorf("automatic palette size needs 0 < MinColors <= MaxColors")
+        }
+        if o.Pad {
+            return fmt.Errorf("padding needs a fixed number of colors")
+        }
+    } else if o.Colors <= 0 {
+        return fmt.Errorf("number of colors must be > 0")
+    }
+    if o.MergeDeltaE < 0 {
+        return fmt.Errorf("merge distance must be >= 0")
+    }
+    if o.MaxPixels < 0 {
+        return fmt.Errorf("max pixels must be >= 0")
+    }
+    // Linear light decodes bytes through the sRGB curve; Lab and OKLab bytes are not sRGB.
+    if o.Space != SpaceRGB && linearLight(o.quantizer()) {
+        return fmt.Errorf("linear-light averaging applies to the rgb color space only")
+    }
+    if o.Banded {
+        mc, ok := o.quantizer().(MedianCut)
+        if !ok {
+            return fmt.Errorf("banded processing supports the mediancut algorithm only")
+        }
+        // Mode counts grow with the number of distinct colors; the banded path
+        // promises a fixed-size histogram.
+        if mc.Rep == RepMode {
+            return fmt.Errorf("banded processing and the mode representative are exclusive")
+        }
+        if o.MaxPixels > 0 {
+            return fmt.Errorf("banded processing and downsampling are exclusive")
+        }
+        // Background detection flood-fills over a full-image grid, which would
+        // undo the memory bound.
+        if o.ExcludeBackground {
+            return fmt.Errorf("banded processing and background exclusion are exclusive")
+        }
+    }
+    return nil
+}
+
+// linearLight reports whether q is a built-in quantizer set to average in linear light.
+func linearLight(q Quantizer) bool {
+    switch q := q.(type) {
+    case MedianCut:
+        return q.Linear
+    case KMeans:
+        return q.Linear
+    case Octree:
+        return q.Linear
+    case Wu:
+        return q.Linear
+    }
+    return false
+}
+
+func (o Options) quantizer() Quantizer {
+    if o.Quantizer == nil {
+        return MedianCut{}
+    }
+    return o.Quantizer
+}
+
+// Palette is the result of Extract.
+type Palette struct {
+    Colors     []RGB       // in quantizer order
+    Counts     []int       // pixels nearest to each color (alpha-weighted under AlphaWeight)
+    Background *Background // set when ExcludeBackground found and removed a backdrop
+}
+
+// Entries returns the colors with shares, most frequent first.
+func (p Palette) Entries() []PaletteEntry {
+    return makeEntries(p.Colors, p.Counts)
+}
+
+// Extract builds the palette of img under opts.
+func Extract(img image.Image, opts Options) (Palette, error) {
+    return ExtractContext(context.Background(), img, opts)
+}
+
+// ExtractContext is Extract that stops with ctx's error once ctx is done. Collection
+// and counting check ctx between blocks of pixels, and so do all built-in quantizers
+// (median cut, octree and Wu in their pixel passes, k-means also between iterations).
+// Other quantizers are checked only if they implement ContextQuantizer.
+func ExtractContext(ctx context.Context, img image.Image, opts Options) (Palette, error) {
+    if err := opts.Validate(); err != nil {
+        return Palette{}, err
+    }
+    opts.Quantizer = opts.quantizer()
+    ctx = withLimiter(ctx, opts.Limiter)
+    colors, counts, bg, err := opts.extract(ctx, img)
+    if err != nil {
+        return Palette{}, err
+    }
+    return Palette{Colors: colors, Counts: counts, Background: bg}, nil
+}
+
+// extract runs the whole pipeline on a decoded image: collect+build, or the
+// banded path.
+func (o Options) extract(ctx context.Context, img image.Image) ([]RGB, []int, *Background, error) {
+    if o.Banded {
+        return o.buildBanded(ctx, img)
+    }
+    s, err := o.collect(ctx, img)
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    palette, counts, err := o.build(ctx, s)
+    return palette, counts, s.background, err
+}
+
+// samples is what collect hands to build.
+type samples struct {
+    pixels     []RGB
+    weights    []uint8     // non-nil only for the weight-by-alpha policy
+    background *Background // set when exclude-bg found and removed a backdrop
+    full       *samples    // full-resolution pixels for counting shares; nil counts on pixels
+}
+
+// collect gathers the pixels to quantize: crop to the region of interest, downsample,
+// then drop the detected background, then apply the alpha policy.
+func (o Options) collect(ctx context.Context, img image.Image) (samples, error) {
+    if !o.Rect.Empty() {
+        cropped, err := CropImage(img, o.Rect)
+        if err != nil {
+            return samples{}, err
+        }
+        img = cropped
+    }
+    small := Downsample(img, o.MaxPixels, o.Sampling)
+    s, err := o.collectFrom(ctx, small)
+    if err != nil {
+        return samples{}, err
+    }
+    if small != img && o.FullCounts {
+        full, err := o.collectFrom(ctx, img)
+        if err != nil {
+            return samples{}, err
+        }
+        s.full = &full
+        s.background = full.background
+    }
+    return s, nil
+}
+
+// collectFrom reads img band by band so long reads can be cancelled and observed.
+func (o Options) collectFrom(ctx context.Context, img image.Image) (samples, error) {
+    var s samples
+    var exclude []bool
+    if o.ExcludeBackground {
+        s.background, exclude = DetectBackground(img, o.BackgroundTolerance)
+    }
+    b := img.Bounds()
+    s.pixels = make([]RGB, 0, b.Dx()*b.Dy())
+    err := forEachBand(ctx, img, o.Alpha, exclude, o.Progress.phase(PhaseCollect), func(pixels []RGB, weights []uint8) {
+        s.pixels = append(s.pixels, pixels...)
+        if weights != nil {
+            s.weights = append(s.weights, weights...)
+        }
+    })
+    return s, err
+}
+
+// shareCounter measures palette shares over the collected pixels: on the
+// working-space copy when work is set, otherwise on the sRGB pixels. decode turns
+// a working-space palette into sRGB through codeMeans.
+type shareCounter interface {
+    countShares(ctx context.Context, palette []RGB, metric Metric, work bool, report func(float64)) ([]int, error)
+    decode(ctx context.Context, raw []RGB, space ColorSpace) ([]RGB, error)
+}
+
+// countSet is an in-memory shareCounter.
+type countSet struct {
+    pixels, work []RGB
+    weights      []uint8
+}
+
+func (cs countSet) countShares(ctx context.Context, palette []RGB, metric Metric, work bool, report func(float64)) ([]int, error) {
+    if work {
+        return countOccurrencesContext(ctx, cs.work, cs.weights, palette, metric, report)
+    }
+    return countOccurrencesContext(ctx, cs.pixels, cs.weights, palette, metric, report)
+}
+
+func (cs countSet) decode(ctx context.Context, raw []RGB, space ColorSpace) ([]RGB, error) {
+    if space == SpaceRGB {
+        return raw, nil
+    }
+    m := newCodeMeans(space, raw)
+    err := forEachBlock(ctx, len(cs.work), func(float64) {}, func(from, to int) {
+        m.add(cs.pixels[from:to], cs.work[from:to], sliceWeights(cs.weights, from, to))
+    })
+    if err != nil {
+        return nil, err
+    }
+    return m.palette(), nil
+}
+
+// build quantizes in the configured space; the palette comes back as sRGB.
+func (o Options) build(ctx context.Context, s samples) ([]RGB, []int, error) {
+    work := o.Space.Encode(s.pixels)
+    cs := countSet{s.pixels, work, s.weights}
+    if s.full != nil {
+        cs = countSet{s.full.pixels, o.Space.Encode(s.full.pixels), s.full.weights}
+    }
+    quantize := func(k int) ([]RGB, error) {
+        return quantizeContext(ctx, o.Quantizer, work, s.weights, k, o.Progress.phase(PhaseQuantize))
+    }
+    var bins []histBin
+    search := quantize
+    if o.AutoColors {
+        h := histogramFor(o.Quantizer)
+        h.AddWeighted(work, s.weights)
+        bins = h.Bins()
+        search = autoSearch(ctx, o.Quantizer, bins, work, s.weights)
+        if _, ok := o.Quantizer.(MedianCut); ok {
+            quantize = search // the chosen cut is already the final palette
+        }
+    }
+    raw, err := o.quantizeAll(bins, search, quantize)
+    if err != nil {
+        return nil, nil, err
+    }
+    return o.finish(ctx, cs, raw, quantize)
+}
+
+// quantizeAll cuts the palette at the requested size. With AutoColors it first
+// picks the size over bins, trying candidates with search, and then cuts once.
+func (o Options) quantizeAll(bins []histBin, search, quantize func(k int) ([]RGB, error)) ([]RGB, error) {
+    k := o.Colors
+    if o.AutoColors {
+        var err error
+        if k, err = autoSize(bins, o.MinColors, o.MaxColors, search, o.Progress.phase(PhaseQuantize)); err != nil {
+            return nil, err
+        }
+    }
+    return quantize(k)
+}
+
+// finish counts shares for raw (a palette in the working space) and applies the
+// merge, refill and pad options; quantize re-cuts at a larger size for refill.
+func (o Options) finish(ctx context.Context, src shareCounter, raw []RGB, quantize func(k int) ([]RGB, error)) ([]RGB, []int, error) {
+    // 1) Shares for the palette as quantized.
+    palette, counts, err := o.decodeCount(ctx, src, raw)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    // 2) Fold near-identical swatches; with refill, cut finer until -n distinct ones remain.
+    if o.MergeDeltaE > 0 {
+        if palette, counts, err = o.merge(ctx, src, palette, counts); err != nil {
+            return nil, nil, err
+        }
+        if o.Refill && !o.AutoColors {
+            for k := o.Colors + 1; len(palette) < o.Colors && k <= refillLimit*o.Colors; k++ {
+                if raw, err = quantize(k); err != nil {
+                    return nil, nil, err
+                }
+                if palette, counts, err = o.decodeCount(ctx, src, raw); err != nil {
+                    return nil, nil, err
+                }
+                if palette, counts, err = o.merge(ctx, src, palette, counts); err != nil {
+                    return nil, nil, err
+                }
+                if len(raw) < k {
+                    break
+                }
+            }
+            if len(palette) > o.Colors {
+                palette = keepLargest(palette, counts, o.Colors)
+                if counts, err = o.count(ctx, src, palette); err != nil {
+                    return nil, nil, err
+                }
+            }
+        }
+    }
+
+    // 3) Legacy fixed-size palette: repeats never win a pixel.
+    if o.Pad && !o.AutoColors {
+        palette = PadPalette(palette, o.Colors)
+        for len(counts) < len(palette) {
+            counts = append(counts, 0)
+        }
+    }
+    return palette, counts, nil
+}
+
+// decodeCount turns a palette in the working space into sRGB with shares. Euclidean
+// counting happens in the working space, perceptual metrics on the sRGB pixels.
+func (o Options) decodeCount(ctx context.Context, src shareCounter, raw []RGB) ([]RGB, []int, error) {
+    report := o.Progress.phase(PhaseCount)
+    palette, err := src.decode(ctx, raw, o.Space)
+    if err != nil {
+        return nil, nil, err
+    }
+    if o.Metric == MetricEuclidean {
+        counts, err := src.countShares(ctx, raw, MetricEuclidean, true, report)
+        return palette, counts, err
+    }
+    counts, err := src.countShares(ctx, palette, o.Metric, false, report)
+    return palette, counts, err
+}
+
+// count re-counts shares for an sRGB palette.
+func (o Options) count(ctx context.Context, src shareCounter, palette []RGB) ([]int, error) {
+    report := o.Progress.phase(PhaseCount)
+    if o.Metric == MetricEuclidean {
+        return src.countShares(ctx, o.Space.Encode(palette), MetricEuclidean, true, report)
+    }
+    return src.countShares(ctx, palette, o.Metric, false, report)
+}
+
+// merge applies MergeSimilar and re-counts when anything was folded.
+func (o Options) merge(ctx context.Context, src shareCounter, palette []RGB, counts []int) ([]RGB, []int, error) {
+    merged := MergeSimilar(palette, counts, o.MergeDeltaE)
+    if len(merged) == len(palette) {
+        return palette, counts, nil
+    }
+    counts, err := o.count(ctx, src, merged)
+    return merged, counts, err
+}
@@ -0,0 +1,218 @@
+package palette
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// Format is a palette file format for ReadPalette and WritePalette.
+type Format int
+
+const (
+    FormatJSON Format = iota // PaletteEntry array, as printed by -json
+    FormatGPL                // GIMP palette
+    FormatHex                // one #RRGGBB per line, optionally followed by count=N
+    FormatCSS                // custom properties on :root (write only)
+)
+
+// ParseFormat maps a format name to a Format.
+func ParseFormat(name string) (Format, error) {
+    switch strings.ToLower(name) {
+    case "json":
+        return FormatJSON, nil
+    case "gpl", "gimp":
+        return FormatGPL, nil
+    case "hex", "txt", "text":
+        return FormatHex, nil
+    case "css":
+        return FormatCSS, nil
+    default:
+        return FormatJSON, fmt.Errorf("unknown palette format %q", name)
+    }
+}
+
+func (f Format) String() string {
+    switch f {
+    case FormatGPL:
+        return "gpl"
+    case FormatHex:
+        return "hex"
+    case FormatCSS:
+        return "css"
+    default:
+        return "json"
+    }
+}
+
+// FormatForPath guesses the format from a file extension.
+func FormatForPath(path string) (Format, bool) {
+    f, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+    return f, err == nil
+}
+
+// WritePalette writes entries in f.
+func WritePalette(w io.Writer, entries []PaletteEntry, f Format) error {
+    switch f {
+    case FormatJSON:
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        return enc.Encode(entries)
+    case FormatGPL:
+        bw := bufio.NewWriter(w)
+        fmt.Fprintf(bw, "GIMP Palette\nName: go-check-color\nColumns: %d\n#\n", len(entries))
+        for _, e := range entries {
+            fmt.Fprintf(bw, "%3d %3d %3d\t%s %.2f%%\n", e.Color.R, e.Color.G, e.Color.B, e.Hex, e.Share*100)
+        }
+        return bw.Flush()
+    case FormatHex:
+        bw := bufio.NewWriter(w)
+        for _, e := range entries {
+            fmt.Fprintf(bw, "%s\tcount=%d\tshare=%.2f%%\n", e.Hex, e.Count, e.Share*100)
+        }
+        return bw.Flush()
+    case FormatCSS:
+        bw := bufio.NewWriter(w)
+        fmt.Fprintln(bw, ":root {")
+        for i, e := range entries {
+            fmt.Fprintf(bw, "  --palette-%d: %s; /* %.2f%% */\n", i+1, e.Hex, e.Share*100)
+        }
+        fmt.Fprintln(bw, "}")
+        return bw.Flush()
+    default:
+        return fmt.Errorf("cannot write palette format %s", f)
+    }
+}
+
+// ReadPalette parses entries written by WritePalette (or by -json, with or without
+// the exclude-bg wrapper). Shares are recomputed from counts when the file has counts;
+// GPL has none and keeps the shares from its names, CSS cannot be read.
+func ReadPalette(r io.Reader, f Format) ([]PaletteEntry, error) {
+    var entries []PaletteEntry
+    switch f {
+    case FormatJSON:
+        data, err := io.ReadAll(r)
+        if err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal(data, &entries); err != nil {
+            var wrapped struct {
+                Palette []PaletteEntry `json:"palette"`
+            }
+            if json.Unmarshal(data, &wrapped) != nil {
+                return nil, fmt.Errorf("json palette: %v", err)
+            }
+            entries = wrapped.Palette
+        }
+        for i := range entries {
+            if entries[i].Hex == "" {
+                entries[i].Hex = toHex(entries[i].Color)
+            }
+        }
+    case FormatGPL, FormatHex:
+        sc := bufio.NewScanner(r)
+        line := 0
+        for sc.Scan() {
+            line++
+            text := strings.TrimSpace(sc.Text())
+            if text == "" || (f == FormatGPL && strings.HasPrefix(text, "#")) {
+                continue
+            }
+            var e PaletteEntry
+            var err error
+            if f == FormatGPL {
+                e, err = parseGPLLine(text)
+            } else {
+                e, err = parseHexLine(text)
+            }
+            if err == errSkipLine {
+                continue
+            }
+            if err != nil {
+                return nil, fmt.Errorf("%s palette line %d: %v", f, line, err)
+            }
+            entries = append(entries, e)
+        }
+        if err := sc.Err(); err != nil {
+            return nil, err
+        }
+    default:
+        return nil, fmt.Errorf("cannot read palette format %s", f)
+    }
+    fillShares(entries)
+    return entries, nil
+}
+
+var errSkipLine = errors.New("skip")
+
+// parseGPLLine reads "R G B [name]"; header lines are skipped. A name ending in
+// "NN.NN%", as WritePalette writes it, gives the share back.
+func parseGPLLine(text string) (PaletteEntry, error) {
+    if text == "GIMP Palette" || strings.HasPrefix(text, "Name:") || strings.HasPrefix(text, "Columns:") {
+        return PaletteEntry{}, errSkipLine
+    }
+    fields := strings.Fields(text)
+    if len(fields) < 3 {
+        return PaletteEntry{}, fmt.Errorf("want R G B, got %q", text)
+    }
+    var v [3]uint8
+    for i := range v {
+        n, err := strconv.ParseUint(fields[i], 10, 8)
+        if err != nil {
+            return PaletteEntry{}, fmt.Errorf("channel %q: %v", fields[i], err)
+        }
+        v[i] = uint8(n)
+    }
+    c := RGB{v[0], v[1], v[2]}
+    e := PaletteEntry{Color: c, Hex: toHex(c)}
+    if len(fields) > 3 {
+        last := fields[len(fields)-1]
+        if v := strings.TrimSuffix(last, "%"); v != last {
+            if share, err := strconv.ParseFloat(v, 64); err == nil && share >= 0 && share <= 100 {
+                e.Share = share / 100
+            }
+        }
+    }
+    return e, nil
+}
+
+// parseHexLine reads "#RRGGBB [count=N] [share=S%]", the text output format; the
+// "background ..." line that -exclude-bg prints first is skipped.
+func parseHexLine(text string) (PaletteEntry, error) {
+    fields := strings.Fields(text)
+    if fields[0] == "background" {
+        return PaletteEntry{}, errSkipLine
+    }
+    c, err := ParseHex(fields[0])
+    if err != nil {
+        return PaletteEntry{}, err
+    }
+    e := PaletteEntry{Color: c, Hex: toHex(c)}
+    for _, f := range fields[1:] {
+        if v := strings.TrimPrefix(f, "count="); v != f {
+            if e.Count, err = strconv.Atoi(v); err != nil {
+                return PaletteEntry{}, fmt.Errorf("count %q: %v", v, err)
+            }
+        }
+    }
+    return e, nil
+}
+
+// fillShares derives shares from counts when any count is set.
+func fillShares(entries []PaletteEntry) {
+    total := 0
+    for _, e := range entries {
+        total += e.Count
+    }
+    if total == 0 {
+        return
+    }
+    for i := range entries {
+        entries[i].Share = float64(entries[i].Count) / float64(total)
+    }
+}
@@ -0,0 +1,206 @@
+package palette
+
+import "sort"
+
+// Reduced-precision color histogram: 5 bits per channel, 32768 cells. Memory is
+// bounded by the cell count instead of the pixel count, while per-cell channel
+// sums keep full 8-bit precision for means. Images with at most exactLimit
+// distinct colors get one bin per exact color instead, so median cut can still
+// separate near-duplicates that share a cell (#000000 and #060606, a gray ramp).
+const (
+    histBits   = 5
+    histShift  = 8 - histBits
+    histSize   = 1 << (3 * histBits)
+    exactLimit = histSize             // distinct colors kept exactly; as many bins as cells at most
+)
+
+// histBin is one occupied histogram cell.
+type histBin struct {
+    C                RGB // mean color of the pixels in the cell
+    N                int // pixel count, or total weight
+    sumR, sumG, sumB int64
+    lin              linearSum
+    mode             RGB // most frequent exact color; only when the histogram tracks modes
+    modeN            int // count (or weight) of mode
+}
+
+type colorHistogram struct {
+    cells    []histBin
+    distinct map[uint32]int // exact color totals by packed RGB; nil once there are more than exactLimit
+    run      RGB            // color of the pending run, folded into distinct on change
+    runW     int
+    modes    [][]uint64     // per-cell exact counts once distinct is gone (see addMode); nil unless tracking modes
+}
+
+// Mode entries pack cellIndex<<modeShift | count.
+const (
+    modeShift = 48
+    modeCount = 1<<modeShift - 1
+)
+
+func newColorHistogram() *colorHistogram {
+    return &colorHistogram{cells: make([]histBin, histSize), distinct: make(map[uint32]int)}
+}
+
+// histogramFor is newColorHistogram, also tracking the exact colors in every cell
+// when q is a median cut that represents boxes by their mode. Below exactLimit
+// colors the exact bins carry their own modes; above it the per-cell counts are
+// sparse, 8 bytes per distinct color.
+func histogramFor(q Quantizer) *colorHistogram {
+    h := newColorHistogram()
+    if mc, ok := q.(MedianCut); ok && mc.Rep == RepMode {
+        h.modes = make([][]uint64, histSize)
+    }
+    return h
+}
+
+// addMode counts w for p among the exact colors of its cell, kept sorted by cellIndex.
+func (h *colorHistogram) addMode(p RGB, w int) {
+    idx := histIndex(p)
+    key := uint64(cellIndex(p)) << modeShift
+    s := h.modes[idx]
+    lo, hi := 0, len(s)
+    for lo < hi {
+        m := (lo + hi) / 2
+        if s[m]&^modeCount < key {
+            lo = m + 1
+        } else {
+            hi = m
+        }
+    }
+    if lo < len(s) && s[lo]&^modeCount == key {
+        s[lo] += uint64(w)
+        return
+    }
+    s = append(s, 0)
+    copy(s[lo+1:], s[lo:])
+    s[lo] = key | uint64(w)
+    h.modes[idx] = s
+}
+
+func histIndex(p RGB) int {
+    return int(p.R>>histShift)<<(2*histBits) | int(p.G>>histShift)<<histBits | int(p.B>>histShift)
+}
+
+// cellIndex locates p among the exact colors of its cell: the bits histIndex drops.
+func cellIndex(p RGB) int {
+    const low = 1<<histShift - 1
+    return int(p.R&low)<<(2*histShift) | int(p.G&low)<<histShift | int(p.B&low)
+}
+
+// cellColor is the color at histIndex idx and cellIndex j.
+func cellColor(idx, j int) RGB {
+    channel := func(hi, lo int) uint8 {
+        return uint8((hi&(1<<histBits-1))<<histShift | lo&(1<<histShift-1))
+    }
+    return RGB{
+        channel(idx>>(2*histBits), j>>(2*histShift)),
+        channel(idx>>histBits, j>>histShift),
+        channel(idx, j),
+    }
+}
+
+// Add accumulates pixels; it can be called repeatedly, e.g. once per tile.
+func (h *colorHistogram) Add(pixels []RGB) {
+    h.AddWeighted(pixels, nil)
+}
+
+// AddWeighted accumulates pixels with per-pixel weights; nil weights count each pixel once.
+func (h *colorHistogram) AddWeighted(pixels []RGB, weights []uint8) {
+    for i, p := range pixels {
+        w := 1
+        if weights != nil {
+            w = int(weights[i])
+        }
+        if h.distinct != nil && w > 0 {
+            // Runs of one color are common in the images that stay under the limit.
+            if p != h.run {
+                h.flushRun()
+                h.run = p
+            }
+            h.runW += w
+        }
+        if h.distinct == nil && h.modes != nil && w > 0 {
+            h.addMode(p, w)
+        }
+        c := &h.cells[histIndex(p)]
+        c.N += w
+        c.sumR += int64(p.R) * int64(w)
+        c.sumG += int64(p.G) * int64(w)
+        c.sumB += int64(p.B) * int64(w)
+        c.lin.add(p, w)
+    }
+}
+
+// flushRun adds the pending run to distinct, dropping distinct once it outgrows exactLimit.
+func (h *colorHistogram) flushRun() {
+    if h.runW == 0 || h.distinct == nil {
+        return
+    }
+    h.distinct[uint32(h.run.R)<<16|uint32(h.run.G)<<8|uint32(h.run.B)] += h.runW
+    h.runW = 0
+    if len(h.distinct) > exactLimit {
+        if h.modes != nil {
+            for key, n := range h.distinct {
+                h.addMode(RGB{uint8(key >> 16), uint8(key >> 8), uint8(key)}, n)
+            }
+        }
+        h.distinct = nil
+    }
+}
+
+// Bins returns the occupied cells in index order with their mean colors, and modes
+// when tracked, filled in; or one bin per exact color while there are at most exactLimit.
+func (h *colorHistogram) Bins() []histBin {
+    h.flushRun()
+    if h.distinct != nil {
+        return h.exactBins()
+    }
+    bins := make([]histBin, 0, 1024)
+    for i, c := range h.cells {
+        if c.N <= 0 {
+            continue
+        }
+        n := int64(c.N)
+        c.C = RGB{
+            uint8((c.sumR + n/2) / n),
+            uint8((c.sumG + n/2) / n),
+            uint8((c.sumB + n/2) / n),
+        }
+        if h.modes != nil && h.modes[i] != nil {
+            // Entries are in color order, so ties go to the lowest color.
+            var best uint64
+            for _, e := range h.modes[i] {
+                if e&modeCount > best&modeCount {
+                    best = e
+                }
+            }
+            c.mode = cellColor(i, int(best>>modeShift))
+            c.modeN = int(best & modeCount)
+        }
+        bins = append(bins, c)
+    }
+    return bins
+}
+
+// exactBins returns one bin per distinct color, in cell order.
+func (h *colorHistogram) exactBins() []histBin {
+    bins := make([]histBin, 0, len(h.distinct))
+    for key, n := range h.distinct {
+        p := RGB{uint8(key >> 16), uint8(key >> 8), uint8(key)}
+        b := histBin{C: p, N: n, mode: p, modeN: n}
+        b.sumR = int64(p.R) * int64(n)
+        b.sumG = int64(p.G) * int64(n)
+        b.sumB = int64(p.B) * int64(n)
+        b.lin.add(p, n)
+        bins = append(bins, b)
+    }
+    sort.Slice(bins, func(i, j int) bool {
+        a, b := bins[i].C, bins[j].C
+        if ia, ib := histIndex(a), histIndex(b); ia != ib {
+            return ia < ib
+        }
+        return cellIndex(a) < cellIndex(b)
+    })
+    return bins
+}
@@ -0,0 +1,90 @@
+package palette
+
+// inverseMapMinPalette: below this size a plain linear scan is already cheap.
+const inverseMapMinPalette = 16
+
+// inverseColorMap lists, for every 5-bit histogram cell, the palette entries that can
+// be nearest to some color inside that cell. A lookup scans only those candidates in
+// palette order, so results match nearestIndex exactly, ties included.
+type inverseColorMap struct {
+    palette []RGB
+    offsets []int32 // candidates of cell i are cands[offsets[i]:offsets[i+1]]
+    cands   []int32
+}
+
+func newInverseColorMap(palette []RGB) *inverseColorMap {
+    m := &inverseColorMap{
+        palette: palette,
+        offsets: make([]int32, histSize+1),
+        cands:   make([]int32, 0, histSize*4),
+    }
+    // 1) Per channel and cell position, the squared distance from each entry to the
+    // nearest and farthest value of that slab; a cell's distance is the sum over
+    // its three slabs.
+    const cells = 1 << histBits
+    n := len(palette)
+    var near, far [3][]int32 // [ch][pos*n+i]
+    for ch := 0; ch < 3; ch++ {
+        near[ch] = make([]int32, cells*n)
+        far[ch] = make([]int32, cells*n)
+        for pos := 0; pos < cells; pos++ {
+            for i, c := range palette {
+                near[ch][pos*n+i], far[ch][pos*n+i] = slabDistanceSq(int(channelValue(c, ch)), pos<<histShift)
+            }
+        }
+    }
+    for cell := 0; cell < histSize; cell++ {
+        nr := near[0][(cell>>(2*histBits))*n:][:n]
+        ng := near[1][(cell>>histBits&(cells-1))*n:][:n]
+        nb := near[2][(cell&(cells-1))*n:][:n]
+        fr := far[0][(cell>>(2*histBits))*n:][:n]
+        fg := far[1][(cell>>histBits&(cells-1))*n:][:n]
+        fb := far[2][(cell&(cells-1))*n:][:n]
+        // 2) The smallest worst-case distance over the cell bounds every nearest candidate.
+        bound := fr[0] + fg[0] + fb[0]
+        for i := 1; i < n; i++ {
+            if d := fr[i] + fg[i] + fb[i]; d < bound {
+                bound = d
+            }
+        }
+        // 3) Keep entries whose best-case distance can reach that bound.
+        for i := 0; i < n; i++ {
+            if nr[i]+ng[i]+nb[i] <= bound {
+                m.cands = append(m.cands, int32(i))
+            }
+        }
+        m.offsets[cell+1] = int32(len(m.cands))
+    }
+    return m
+}
+
+// slabDistanceSq: squared distance from channel value v to the nearest and the
+// farthest value of the cell slab [lo, lo+side).
+func slabDistanceSq(v, lo int) (near, far int32) {
+    hi := lo + 1<<histShift - 1
+    var dn int
+    if v < lo {
+        dn = lo - v
+    } else if v > hi {
+        dn = v - hi
+    }
+    df := v - lo
+    if hi-v > df {
+        df = hi - v
+    }
+    return int32(dn * dn), int32(df * df)
+}
+
+func (m *inverseColorMap) nearest(px RGB) int {
+    cell := histIndex(px)
+    cands := m.cands[m.offsets[cell]:m.offsets[cell+1]]
+    bestIdx := int(cands[0])
+    best := colorDistanceSqInt(px, m.palette[bestIdx])
+    for _, i := range cands[1:] {
+        if d := colorDistanceSqInt(px, m.palette[i]); d < best {
+            best = d
+            bestIdx = int(i)
+        }
+    }
+    return bestIdx
+}
@@ -0,0 +1,95 @@
+package palette
+
+import (
+    "fmt"
+    "math/rand"
+    "testing"
+)
+
+func randomColors(rng *rand.Rand, n int) []RGB {
+    colors := make([]RGB, n)
+    for i := range colors {
+        colors[i] = RGB{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+    }
+    return colors
+}
+
+// TestInverseColorMapMatchesLinearScan checks the promise in the inverseColorMap doc
+// comment: the same index as nearestIndex for every pixel, ties included.
+func TestInverseColorMapMatchesLinearScan(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    for _, n := range []int{1, 2, 16, 64, 256} {
+        for trial := 0; trial < 4; trial++ {
+            palette := randomColors(rng, n)
+            // Duplicates and near-duplicates make ties: the lowest index must win.
+            for i := 0; i+1 < n; i += 5 {
+                palette[i+1] = palette[i]
+            }
+            if n > 3 {
+                palette[n-1] = palette[0]
+                palette[2] = RGB{palette[1].R ^ 1, palette[1].G, palette[1].B}
+            }
+            m := newInverseColorMap(palette)
+            pixels := randomColors(rng, 20000)
+            pixels = append(pixels, palette...)
+            for _, c := range palette {
+                // Points halfway between entries are where ties happen.
+                pixels = append(pixels, RGB{c.R / 2, c.G / 2, c.B / 2}, RGB{c.R | 7, c.G &^ 7, c.B ^ 8})
+            }
+            for _, px := range pixels {
+                if got, want := m.nearest(px), nearestIndex(px, palette); got != want {
+                    t.Fatalf("n=%d trial=%d px=%v: inverse map %d (%v), linear scan %d (%v)",
+                        n, trial, px, got, palette[got], want, palette[want])
+                }
+            }
+        }
+    }
+}
+
+// TestInverseColorMapExhaustive compares against the linear scan on every color of a
+// coarse lattice that covers all cells and their borders.
+func TestInverseColorMapExhaustive(t *testing.T) {
+    rng := rand.New(rand.NewSource(2))
+    palette := randomColors(rng, 32)
+    palette = append(palette, palette[3], palette[17])
+    m := newInverseColorMap(palette)
+    for r := 0; r < 256; r += 7 {
+        for g := 0; g < 256; g += 7 {
+            for b := 0; b < 256; b += 7 {
+                px := RGB{uint8(r), uint8(g), uint8(b)}
+                if got, want := m.nearest(px), nearestIndex(px, palette); got != want {
+                    t.Fatalf("px=%v: inverse map %d, linear scan %d", px, got, want)
+                }
+            }
+        }
+    }
+}
+
+// BenchmarkCountOccurrences compares the linear scan with the inverse color map
+// over 1M random pixels.
+func BenchmarkCountOccurrences(b *testing.B) {
+    rng := rand.New(rand.NewSource(3))
+    pixels := randomColors(rng, 1<<20)
+    for _, n := range []int{16, 64, 256} {
+        palette := randomColors(rng, n)
+        b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+            nearest := func(px RGB) int { return nearestIndex(px, palette) }
+            for i := 0; i < b.N; i++ {
+                countNearest(nil, pixels, nil, n, nearest)
+            }
+        })
+        b.Run(fmt.Sprintf("invmap/%d", n), func(b *testing.B) {
+            for i := 0; i < b.N; i++ {
+                // Building the map is part of every CountOccurrences call.
+                countNearest(nil, pixels, nil, n, newInverseColorMap(palette).nearest)
+            }
+        })
+        b.Run(fmt.Sprintf("invmap-lookup/%d", n), func(b *testing.B) {
+            m := newInverseColorMap(palette)
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                countNearest(nil, pixels, nil, n, m.nearest)
+            }
+        })
+    }
+}
@@ -0,0 +1,152 @@
+package palette
+
+import (
+    "sort"
+    "testing"
+)
+
+// pixelMedianCut is the median cut MedianCutPalette ran before the histogram: boxes
+// hold pixel copies and split at the exact pixel median of the widest channel.
+func pixelMedianCut(pixels []RGB, k int) []RGB {
+    rangeOf := func(pxs []RGB, ch int) int {
+        minv, maxv := 255, 0
+        for _, p := range pxs {
+            v := int(channelValue(p, ch))
+            if v < minv {
+                minv = v
+            }
+            if v > maxv {
+                maxv = v
+            }
+        }
+        return maxv - minv
+    }
+    widest := func(pxs []RGB) (int, int) {
+        ch, r := 0, rangeOf(pxs, 0)
+        for c := 1; c < 3; c++ {
+            if v := rangeOf(pxs, c); v > r {
+                ch, r = c, v
+            }
+        }
+        return ch, r
+    }
+    median := func(pxs []RGB) RGB {
+        n := len(pxs)
+        if n <= 3 {
+            var r, g, b int
+            for _, p := range pxs {
+                r, g, b = r+int(p.R), g+int(p.G), b+int(p.B)
+            }
+            return RGB{uint8(r / n), uint8(g / n), uint8(b / n)}
+        }
+        var out [3]uint8
+        for ch := 0; ch < 3; ch++ {
+            vals := make([]int, n)
+            for i, p := range pxs {
+                vals[i] = int(channelValue(p, ch))
+            }
+            sort.Ints(vals)
+            if n%2 == 1 {
+                out[ch] = uint8(vals[n/2])
+            } else {
+                out[ch] = uint8((vals[n/2-1] + vals[n/2]) / 2)
+            }
+        }
+        return RGB{out[0], out[1], out[2]}
+    }
+
+    boxes := [][]RGB{append([]RGB(nil), pixels...)}
+    for len(boxes) < k {
+        best, bestRange := -1, -1
+        for i, b := range boxes {
+            if len(b) <= 1 {
+                continue
+            }
+            if _, r := widest(b); r > bestRange {
+                best, bestRange = i, r
+            }
+        }
+        if best == -1 {
+            break
+        }
+        box := boxes[best]
+        ch, _ := widest(box)
+        sort.SliceStable(box, func(i, j int) bool { return channelValue(box[i], ch) < channelValue(box[j], ch) })
+        mid := len(box) / 2
+        boxes[best] = box[:mid]
+        boxes = append(boxes, box[mid:])
+    }
+    palette := make([]RGB, 0, len(boxes))
+    for _, b := range boxes {
+        palette = append(palette, median(b))
+    }
+    return palette
+}
+
+// distinctSorted drops the repeats the pixel version makes when it splits one color.
+func distinctSorted(colors []RGB) []RGB {
+    seen := make(map[RGB]bool)
+    var out []RGB
+    for _, c := range colors {
+        if !seen[c] {
+            seen[c] = true
+            out = append(out, c)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        a, b := out[i], out[j]
+        if a.R != b.R {
+            return a.R < b.R
+        }
+        if a.G != b.G {
+            return a.G < b.G
+        }
+        return a.B < b.B
+    })
+    return out
+}
+
+// TestMedianCutMatchesPixelVersion guards the equivalence promise of the histogram
+// median cut on near-duplicate colors that share one 5-bit cell.
+func TestMedianCutMatchesPixelVersion(t *testing.T) {
+    repeat := func(c RGB, n int) []RGB {
+        out := make([]RGB, n)
+        for i := range out {
+            out[i] = c
+        }
+        return out
+    }
+    var halves, ramp, cell []RGB
+    halves = append(repeat(RGB{0, 0, 0}, 5000), repeat(RGB{6, 6, 6}, 5000)...)
+    for v := 0; v < 256; v++ {
+        ramp = append(ramp, repeat(RGB{uint8(v), uint8(v), uint8(v)}, 10)...)
+    }
+    for i := 0; i < 8; i++ {
+        cell = append(cell, repeat(RGB{uint8(64 + i), 128, 200}, 100)...)
+    }
+    cases := []struct {
+        name   string
+        pixels []RGB
+        k      int
+    }{
+        {"halves", halves, 2},
+        {"gray ramp", ramp, 64},
+        {"gray ramp all", ramp, 256},
+        {"one cell", cell, 8},
+        {"one cell halved", cell, 4},
+    }
+    for _, c := range cases {
+        got := distinctSorted(MedianCutPalette(c.pixels, c.k))
+        want := distinctSorted(pixelMedianCut(c.pixels, c.k))
+        if len(got) != len(want) {
+            t.Errorf("%s: %d colors, pixel version %d: %v vs %v", c.name, len(got), len(want), got, want)
+            continue
+        }
+        for i := range got {
+            if got[i] != want[i] {
+                t.Errorf("%s: %v, pixel version %v", c.name, got, want)
+                break
+            }
+        }
+    }
+}
@@ -0,0 +1,98 @@
+package palette
+
+import (
+    "math"
+    "sort"
+)
+
+// refillLimit bounds the re-split search for -merge-refill: at most refillLimit*n colors are cut.
+const refillLimit = 4
+
+// MergeSimilar folds palette entries closer than deltaE (CIEDE2000) into one, closest
+// pair first. The merged color is the count-weighted mean of the pair in CIELAB and
+// takes the place of the earlier entry. counts weight the means only; callers re-count
+// shares against the returned palette.
+func MergeSimilar(palette []RGB, counts []int, deltaE float64) []RGB {
+    if deltaE <= 0 || len(palette) < 2 {
+        return palette
+    }
+    labs := make([]lab, len(palette))
+    weights := make([]float64, len(palette))
+    for i, c := range palette {
+        labs[i] = newLab(c)
+        if i < len(counts) {
+            weights[i] = float64(counts[i])
+        }
+    }
+    alive := make([]bool, len(palette))
+    for i := range alive {
+        alive[i] = true
+    }
+    mergedInto := make([]bool, len(palette))
+    limit := deltaE * deltaE
+    for {
+        // 1) Closest remaining pair.
+        bi, bj := -1, -1
+        best := limit
+        for i := range labs {
+            if !alive[i] {
+                continue
+            }
+            for j := i + 1; j < len(labs); j++ {
+                if !alive[j] {
+                    continue
+                }
+                if d := ciede2000DistanceSq(labs[i], labs[j]); d < best {
+                    best, bi, bj = d, i, j
+                }
+            }
+        }
+        if bi < 0 {
+            break
+        }
+        // 2) Weighted mean in Lab; two empty swatches average evenly.
+        wi, wj := weights[bi], weights[bj]
+        if wi+wj == 0 {
+            wi, wj = 1, 1
+        }
+        t := wj / (wi + wj)
+        l := labs[bi].l + (labs[bj].l-labs[bi].l)*t
+        a := labs[bi].a + (labs[bj].a-labs[bi].a)*t
+        b := labs[bi].b + (labs[bj].b-labs[bi].b)*t
+        labs[bi] = lab{l: l, a: a, b: b, c: math.Hypot(a, b)}
+        weights[bi] += weights[bj]
+        alive[bj] = false
+        mergedInto[bi] = true
+    }
+    merged := make([]RGB, 0, len(palette))
+    for i, ok := range alive {
+        if !ok {
+            continue
+        }
+        if !mergedInto[i] {
+            merged = append(merged, palette[i]) // untouched entries keep their exact color
+            continue
+        }
+        merged = append(merged, fromLab(labs[i].l, labs[i].a, labs[i].b))
+    }
+    return merged
+}
+
+// keepLargest drops the least populated entries beyond n, preserving order.
+func keepLargest(palette []RGB, counts []int, n int) []RGB {
+    if len(palette) <= n {
+        return palette
+    }
+    idx := make([]int, len(palette))
+    for i := range idx {
+        idx[i] = i
+    }
+    sort.SliceStable(idx, func(a, b int) bool { return counts[idx[a]] > counts[idx[b]] })
+    keep := idx[:n]
+    sort.Ints(keep)
+    out := make([]RGB, 0, n)
+    for _, i := range keep {
+        out = append(out, palette[i])
+    }
+    return out
+}
@@ -0,0 +1,225 @@
+package palette
+
+import (
+    "fmt"
+    "math"
+    "strings"
+    "sync/atomic"
+)
+
+// Metric selects how CountOccurrencesMetric measures pixel-to-swatch distance.
+type Metric int
+
+const (
+    MetricEuclidean Metric = iota // squared distance on the byte triples as given
+    MetricRedmean                 // weighted sRGB approximation of perceived difference
+    MetricCIE76                   // Euclidean distance in CIELAB
+    MetricCIE94                   // CIE94, graphic arts weights
+    MetricCIEDE2000               // CIEDE2000
+)
+
+// ParseMetric maps the -metric flag value to a Metric.
+func ParseMetric(name string) (Metric, error) {
+    switch strings.ToLower(name) {
+    case "", "euclidean", "rgb":
+        return MetricEuclidean, nil
+    case "redmean":
+        return MetricRedmean, nil
+    case "cie76", "de76":
+        return MetricCIE76, nil
+    case "cie94", "de94":
+        return MetricCIE94, nil
+    case "ciede2000", "de2000":
+        return MetricCIEDE2000, nil
+    default:
+        return MetricEuclidean, fmt.Errorf("unknown metric %q", name)
+    }
+}
+
+func (m Metric) String() string {
+    switch m {
+    case MetricRedmean:
+        return "redmean"
+    case MetricCIE76:
+        return "cie76"
+    case MetricCIE94:
+        return "cie94"
+    case MetricCIEDE2000:
+        return "ciede2000"
+    default:
+        return "euclidean"
+    }
+}
+
+// nearestFunc returns a pixel -> palette index lookup for m. The result only reads
+// precomputed state, so CountOccurrencesMetric can share it across goroutines.
+func (m Metric) nearestFunc(palette []RGB) func(RGB) int {
+    switch m {
+    case MetricRedmean:
+        return func(px RGB) int {
+            bestIdx := 0
+            best := redmeanDistanceSq(px, palette[0])
+            for i := 1; i < len(palette); i++ {
+                if d := redmeanDistanceSq(px, palette[i]); d < best {
+                    best = d
+                    bestIdx = i
+                }
+            }
+            return bestIdx
+        }
+    case MetricCIE76, MetricCIE94, MetricCIEDE2000:
+        // Convert the palette once; memoizeNearest converts each distinct color about once.
+        labs := make([]lab, len(palette))
+        for i, c := range palette {
+            labs[i] = newLab(c)
+        }
+        dist := cie76DistanceSq
+        if m == MetricCIE94 {
+            dist = cie94DistanceSq
+        } else if m == MetricCIEDE2000 {
+            dist = ciede2000DistanceSq
+        }
+        return memoizeNearest(func(px RGB) int {
+            p := newLab(px)
+            bestIdx := 0
+            best := dist(p, labs[0])
+            for i := 1; i < len(labs); i++ {
+                if d := dist(p, labs[i]); d < best {
+                    best = d
+                    bestIdx = i
+                }
+            }
+            return bestIdx
+        })
+    default:
+        if len(palette) >= inverseMapMinPalette {
+            return newInverseColorMap(palette).nearest
+        }
+        return func(px RGB) int { return nearestIndex(px, palette) }
+    }
+}
+
+// memoBits sizes the memoizeNearest cache: 1<<memoBits entries of 8 bytes.
+const memoBits = 20
+
+// memoizeNearest caches nearest per color in a direct-mapped table, so the costly
+// Lab lookups run about once per distinct color instead of once per pixel. Each
+// slot packs the full 24-bit color with the index and is read and written
+// atomically, so the result stays exact and safe to share across goroutines.
+func memoizeNearest(nearest func(RGB) int) func(RGB) int {
+    slots := make([]uint64, 1<<memoBits)
+    return func(px RGB) int {
+        key := uint64(px.R)<<16 | uint64(px.G)<<8 | uint64(px.B)
+        slot := &slots[uint32(key*0x9E3779B1)>>(32-memoBits)]
+        // Slot layout: color in bits 32..55, index+1 in bits 0..31; 0 is empty.
+        if v := atomic.LoadUint64(slot); v != 0 && v>>32 == key {
+            return int(uint32(v)) - 1
+        }
+        idx := nearest(px)
+        atomic.StoreUint64(slot, key<<32|uint64(idx+1))
+        return idx
+    }
+}
+
+// redmeanDistanceSq: "redmean" weighting in fixed point (weights scaled by 256).
+func redmeanDistanceSq(a, b RGB) int {
+    rmean := (int(a.R) + int(b.R)) / 2
+    dr := int(a.R) - int(b.R)
+    dg := int(a.G) - int(b.G)
+    db := int(a.B) - int(b.B)
+    return (512+rmean)*dr*dr + 1024*dg*dg + (767-rmean)*db*db
+}
+
+type lab struct {
+    l, a, b float64
+    c       float64 // chroma, cached for CIE94/CIEDE2000
+}
+
+func newLab(c RGB) lab {
+    l, a, b := toLab(c)
+    return lab{l: l, a: a, b: b, c: math.Hypot(a, b)}
+}
+
+func cie76DistanceSq(p, ref lab) float64 {
+    dl, da, db := p.l-ref.l, p.a-ref.a, p.b-ref.b
+    return dl*dl + da*da + db*db
+}
+
+// cie94DistanceSq uses the palette color as reference (kL = kC = kH = 1).
+func cie94DistanceSq(p, ref lab) float64 {
+    dl := p.l - ref.l
+    dc := p.c - ref.c
+    da, db := p.a-ref.a, p.b-ref.b
+    dh2 := da*da + db*db - dc*dc
+    if dh2 < 0 {
+        dh2 = 0
+    }
+    sc := 1 + 0.045*ref.c
+    sh := 1 + 0.015*ref.c
+    return dl*dl + dc*dc/(sc*sc) + dh2/(sh*sh)
+}
+
+// ciede2000DistanceSq follows Sharma, Wu & Dalal (2005) with kL = kC = kH = 1.
+func ciede2000DistanceSq(p, ref lab) float64 {
+    const pow25to7 = 6103515625.0 // 25^7
+    cBar := (p.c + ref.c) / 2
+    cBar7 := math.Pow(cBar, 7)
+    g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+pow25to7)))
+    a1, a2 := (1+g)*p.a, (1+g)*ref.a
+    c1, c2 := math.Hypot(a1, p.b), math.Hypot(a2, ref.b)
+    h1, h2 := hueAngle(p.b, a1), hueAngle(ref.b, a2)
+
+    dL := ref.l - p.l
+    dC := c2 - c1
+    var dh float64
+    if c1*c2 != 0 {
+        dh = h2 - h1
+        if dh > 180 {
+            dh -= 360
+        } else if dh < -180 {
+            dh += 360
+        }
+    }
+    dH := 2 * math.Sqrt(c1*c2) * math.Sin(dh*math.Pi/360)
+
+    lBar := (p.l + ref.l) / 2
+    cBarP := (c1 + c2) / 2
+    hBar := h1 + h2
+    if c1*c2 != 0 {
+        if math.Abs(h1-h2) > 180 {
+            if hBar < 360 {
+                hBar += 360
+            } else {
+                hBar -= 360
+            }
+        }
+        hBar /= 2
+    }
+    t := 1 - 0.17*math.Cos((hBar-30)*math.Pi/180) +
+        0.24*math.Cos(2*hBar*math.Pi/180) +
+        0.32*math.Cos((3*hBar+6)*math.Pi/180) -
+        0.20*math.Cos((4*hBar-63)*math.Pi/180)
+    dTheta := 30 * math.Exp(-math.Pow((hBar-275)/25, 2))
+    cBarP7 := math.Pow(cBarP, 7)
+    rc := 2 * math.Sqrt(cBarP7/(cBarP7+pow25to7))
+    l50 := (lBar - 50) * (lBar - 50)
+    sl := 1 + 0.015*l50/math.Sqrt(20+l50)
+    sc := 1 + 0.045*cBarP
+    sh := 1 + 0.015*cBarP*t
+    rt := -math.Sin(2*dTheta*math.Pi/180) * rc
+
+    tl, tc, th := dL/sl, dC/sc, dH/sh
+    return tl*tl + tc*tc + th*th + rt*tc*th
+}
+
+// hueAngle returns atan2(b, a) in degrees within [0, 360).
+func hueAngle(b, a float64) float64 {
+    if a == 0 && b == 0 {
+        return 0
+    }
+    h := math.Atan2(b, a) * 180 / math.Pi
+    if h < 0 {
+        h += 360
+    }
+    return h
+}
@@ -0,0 +1,218 @@
+package palette
+
+import (
+    "container/heap"
+    "context"
+    "math"
+    "sort"
+)
+
+// Octree quantizer (Gervautz–Purgathofer). Leaves are merged bottom-up, least
+// populated subtrees first, so small but distinct color clusters survive longer than with median cut.
+type Octree struct {
+    Linear bool // average leaf colors in linear light
+}
+
+func (q Octree) Quantize(pixels []RGB, k int) []RGB {
+    return q.QuantizeWeighted(pixels, nil, k)
+}
+
+func (q Octree) QuantizeWeighted(pixels []RGB, weights []uint8, k int) []RGB {
+    palette, _, _ := octreePalette(context.Background(), pixels, weights, k, q.Linear, func(float64) {})
+    return palette
+}
+
+// QuantizeContext checks ctx and reports progress between blocks of the insert pass.
+func (q Octree) QuantizeContext(ctx context.Context, pixels []RGB, weights []uint8, k int, report func(float64)) ([]RGB, error) {
+    palette, _, err := octreePalette(ctx, pixels, weights, k, q.Linear, report)
+    return palette, err
+}
+
+// octreeDepth: leaves sit at 6 levels (top 6 bits per channel); sums keep full precision.
+const octreeDepth = 6
+
+type octreeNode struct {
+    children [8]*octreeNode
+    parent   *octreeNode
+    inner    int // children that are not leaves yet
+    r, g, b  int64
+    lin      linearSum
+    n        int
+    leaf     bool
+}
+
+type octree struct {
+    root   *octreeNode
+    leaves int
+}
+
+// reducibleHeap orders nodes whose children are all leaves by population.
+type reducibleHeap []*octreeNode
+
+func (h reducibleHeap) Len() int            { return len(h) }
+func (h reducibleHeap) Less(i, j int) bool  { return h[i].n < h[j].n }
+func (h reducibleHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *reducibleHeap) Push(x interface{}) { *h = append(*h, x.(*octreeNode)) }
+func (h *reducibleHeap) Pop() interface{} {
+    old := *h
+    x := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return x
+}
+
+// OctreePalette returns up to k colors plus the number of pixels merged into each leaf.
+func OctreePalette(pixels []RGB, k int) ([]RGB, []int) {
+    return OctreePaletteWeighted(pixels, nil, k)
+}
+
+// OctreePaletteWeighted is OctreePalette with per-pixel weights (nil = uniform);
+// counts are then total weights per leaf.
+func OctreePaletteWeighted(pixels []RGB, weights []uint8, k int) ([]RGB, []int) {
+    palette, counts, _ := octreePalette(context.Background(), pixels, weights, k, false, func(float64) {})
+    return palette, counts
+}
+
+func octreePalette(ctx context.Context, pixels []RGB, weights []uint8, k int, linear bool, report func(float64)) ([]RGB, []int, error) {
+    if k <= 0 || len(pixels) == 0 {
+        report(1)
+        return nil, nil, nil
+    }
+    // 1) Insert every pixel, counting populations along the path. The tree never
+    // exceeds 8^octreeDepth leaves, so the later steps need no ctx checks.
+    t := &octree{root: &octreeNode{}}
+    err := forEachBlock(ctx, len(pixels), report, func(from, to int) {
+        for i := from; i < to; i++ {
+            w := 1
+            if weights != nil {
+                w = int(weights[i])
+            }
+            if w > 0 {
+                t.insert(pixels[i], w)
+            }
+        }
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    // 2) Repeatedly fold the least populated node whose children are all leaves.
+    var h reducibleHeap
+    var seed func(node *octreeNode)
+    seed = func(node *octreeNode) {
+        if node.leaf {
+            return
+        }
+        if node.inner == 0 {
+            h = append(h, node)
+            return
+        }
+        for _, c := range node.children {
+            if c != nil {
+                seed(c)
+            }
+        }
+    }
+    seed(t.root)
+    heap.Init(&h)
+    for t.leaves > k && h.Len() > 0 {
+        node := heap.Pop(&h).(*octreeNode)
+        if !t.reduce(node, k) {
+            break
+        }
+        if p := node.parent; p != nil {
+            p.inner--
+            if p.inner == 0 {
+                heap.Push(&h, p)
+            }
+        }
+    }
+    // 3) Collect leaves in tree order.
+    palette := make([]RGB, 0, t.leaves)
+    counts := make([]int, 0, t.leaves)
+    var walk func(node *octreeNode)
+    walk = func(node *octreeNode) {
+        if node.leaf {
+            n := float64(node.n)
+            c := RGB{
+                uint8(math.Round(float64(node.r) / n)),
+                uint8(math.Round(float64(node.g) / n)),
+                uint8(math.Round(float64(node.b) / n)),
+            }
+            if linear {
+                c = node.lin.mean(node.n)
+            }
+            palette = append(palette, c)
+            counts = append(counts, node.n)
+            return
+        }
+        for _, c := range node.children {
+            if c != nil {
+                walk(c)
+            }
+        }
+    }
+    walk(t.root)
+    return palette, counts, nil
+}
+
+func (t *octree) insert(p RGB, w int) {
+    node := t.root
+    node.n += w
+    for level := 0; level < octreeDepth; level++ {
+        shift := 7 - level
+        idx := (int(p.R>>shift)&1)<<2 | (int(p.G>>shift)&1)<<1 | int(p.B>>shift)&1
+        child := node.children[idx]
+        if child == nil {
+            child = &octreeNode{parent: node}
+            if level == octreeDepth-1 {
+                child.leaf = true
+                t.leaves++
+            } else {
+                node.inner++
+            }
+            node.children[idx] = child
+        }
+        child.n += w
+        node = child
+    }
+    node.r += int64(p.R) * int64(w)
+    node.g += int64(p.G) * int64(w)
+    node.b += int64(p.B) * int64(w)
+    node.lin.add(p, w)
+}
+
+// reduce folds the leaf children of node into node itself. When a full fold would
+// drop below k leaves, only the least populated children are merged into one leaf.
+func (t *octree) reduce(node *octreeNode, k int) bool {
+    kids := make([]int, 0, 8)
+    for i, c := range node.children {
+        if c != nil {
+            kids = append(kids, i)
+        }
+    }
+    if t.leaves-(len(kids)-1) < k {
+        sort.Slice(kids, func(a, b int) bool { return node.children[kids[a]].n < node.children[kids[b]].n })
+        into := node.children[kids[0]]
+        for _, i := range kids[1 : t.leaves-k+1] {
+            c := node.children[i]
+            into.r += c.r
+            into.g += c.g
+            into.b += c.b
+            into.lin.merge(c.lin)
+            into.n += c.n
+            node.children[i] = nil
+        }
+        t.leaves = k
+        return false
+    }
+    for _, i := range kids {
+        c := node.children[i]
+        node.r += c.r
+        node.g += c.g
+        node.b += c.b
+        node.lin.merge(c.lin)
+        node.children[i] = nil
+    }
+    node.leaf = true
+    t.leaves -= len(kids) - 1
+    return true
+}
@@ -0,0 +1,557 @@
+// Package palette extracts color palettes from images: quantization (median cut,
+// k-means, octree, Wu), share counting, and palette strip rendering. Extract runs
+// the whole pipeline; the building blocks are exported for callers that need less.
+package palette
+
+import (
+    "context"
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "math"
+    "os"
+    "runtime"
+    "sync"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// RGB is an 8-bit sRGB color.
+type RGB struct {
+    R uint8 `json:"r"`
+    G uint8 `json:"g"`
+    B uint8 `json:"b"`
+}
+
+type colorBox struct {
+    Bins  []histBin
+    Count int
+    score float64 // split priority under the active SplitStrategy
+}
+
+func channelRange(bins []histBin, ch int) int {
+    if len(bins) == 0 {
+        return 0
+    }
+    minv, maxv := 255, 0
+    for _, b := range bins {
+        v := int(channelValue(b.C, ch))
+        if v < minv {
+            minv = v
+        }
+        if v > maxv {
+            maxv = v
+        }
+    }
+    return maxv - minv
+}
+
+// medianCutSplit: sort the box's bins in place by dominant channel and cut at the
+// population median. Both halves are sub-slices of the input, nothing is copied.
+func medianCutSplit(box colorBox) (colorBox, colorBox) {
+    // 1) Pick dominant channel by range.
+    ranges := []int{channelRange(box.Bins, 0), channelRange(box.Bins, 1), channelRange(box.Bins, 2)}
+    dominant := 0
+    if ranges[1] > ranges[dominant] {
+        dominant = 1
+    }
+    if ranges[2] > ranges[dominant] {
+        dominant = 2
+    }
+    // 2) Order bins along dominant channel.
+    bins := box.Bins
+    sort.Slice(bins, func(i, j int) bool {
+        return channelValue(bins[i].C, dominant) < channelValue(bins[j].C, dominant)
+    })
+    // 3) Cut at the bin boundary closest to half the population, keeping both sides non-empty.
+    mid := box.Count / 2
+    cut, cum := 0, 0
+    for cut < len(bins) && cum+bins[cut].N <= mid {
+        cum += bins[cut].N
+        cut++
+    }
+    if cut < len(bins) && mid-cum > cum+bins[cut].N-mid {
+        cum += bins[cut].N
+        cut++
+    }
+    if cut == 0 {
+        cum += bins[0].N
+        cut = 1
+    } else if cut == len(bins) {
+        cut--
+        cum -= bins[cut].N
+    }
+    return colorBox{Bins: bins[:cut], Count: cum}, colorBox{Bins: bins[cut:], Count: box.Count - cum}
+}
+
+func channelValue(c RGB, ch int) uint8 {
+    switch ch {
+    case 0:
+        return c.R
+    case 1:
+        return c.G
+    default:
+        return c.B
+    }
+}
+
+// averageColor: population-weighted mean from the exact per-bin sums, in linear
+// light when requested.
+func averageColor(bins []histBin, linear bool) RGB {
+    var rsum, gsum, bsum, n int64
+    var lin linearSum
+    for _, b := range bins {
+        rsum += b.sumR
+        gsum += b.sumG
+        bsum += b.sumB
+        lin.merge(b.lin)
+        n += int64(b.N)
+    }
+    if n == 0 {
+        return RGB{0, 0, 0}
+    }
+    if linear {
+        return lin.mean(int(n))
+    }
+    r := uint8(math.Round(float64(rsum) / float64(n)))
+    g := uint8(math.Round(float64(gsum) / float64(n)))
+    b := uint8(math.Round(float64(bsum) / float64(n)))
+    return RGB{r, g, b}
+}
+
+// medianColor: per-channel weighted median over bin means, via 256-entry counts.
+// The median itself does not depend on gamma; the averages taken for tiny boxes and
+// for the middle pair of an even population do, and use linear light when requested.
+func medianColor(bins []histBin, linear bool) RGB {
+    var hr, hg, hb [256]int
+    n := 0
+    for _, b := range bins {
+        hr[b.C.R] += b.N
+        hg[b.C.G] += b.N
+        hb[b.C.B] += b.N
+        n += b.N
+    }
+    if n == 0 {
+        return RGB{0, 0, 0}
+    }
+    if n <= 3 && linear {
+        var lin linearSum
+        for _, b := range bins {
+            lin.add(b.C, b.N)
+        }
+        return lin.mean(n)
+    }
+    if n <= 3 {
+        var rsum, gsum, bsum int
+        for _, b := range bins {
+            rsum += int(b.C.R) * b.N
+            gsum += int(b.C.G) * b.N
+            bsum += int(b.C.B) * b.N
+        }
+        return RGB{uint8(rsum / n), uint8(gsum / n), uint8(bsum / n)}
+    }
+    mid := n / 2
+    if n%2 == 1 {
+        return RGB{nthValue(&hr, mid), nthValue(&hg, mid), nthValue(&hb, mid)}
+    }
+    if linear {
+        return RGB{
+            linearMid(nthValue(&hr, mid-1), nthValue(&hr, mid)),
+            linearMid(nthValue(&hg, mid-1), nthValue(&hg, mid)),
+            linearMid(nthValue(&hb, mid-1), nthValue(&hb, mid)),
+        }
+    }
+    return RGB{
+        uint8((int(nthValue(&hr, mid-1)) + int(nthValue(&hr, mid))) / 2),
+        uint8((int(nthValue(&hg, mid-1)) + int(nthValue(&hg, mid))) / 2),
+        uint8((int(nthValue(&hb, mid-1)) + int(nthValue(&hb, mid))) / 2),
+    }
+}
+
+// nthValue returns the k-th smallest (0-based) value described by counts.
+func nthValue(counts *[256]int, k int) uint8 {
+    cum := 0
+    for v, c := range counts {
+        cum += c
+        if cum > k {
+            return uint8(v)
+        }
+    }
+    return 255
+}
+
+// MedianCutPalette returns up to k colors; fewer when the pixels run out of distinct colors.
+func MedianCutPalette(pixels []RGB, k int) []RGB {
+    return MedianCutPaletteWeighted(pixels, nil, k)
+}
+
+// MedianCutPaletteWeighted is MedianCutPalette with per-pixel weights (nil = uniform).
+func MedianCutPaletteWeighted(pixels []RGB, weights []uint8, k int) []RGB {
+    palette, _ := medianCutPalette(context.Background(), pixels, weights, k, MedianCut{}, func(float64) {})
+    return palette
+}
+
+func medianCutPalette(ctx context.Context, pixels []RGB, weights []uint8, k int, opts MedianCut, report func(float64)) ([]RGB, error) {
+    if k <= 0 {
+        return nil, nil
+    }
+    // 1) Trivial cases.
+    if len(pixels) == 0 {
+        return nil, nil
+    }
+    if len(pixels) <= k {
+        // Every distinct color gets its own entry; no repeats.
+        seen := make(map[RGB]bool, len(pixels))
+        result := make([]RGB, 0, len(pixels))
+        for i, p := range pixels {
+            if seen[p] || (weights != nil && weights[i] == 0) {
+                continue
+            }
+            seen[p] = true
+            result = append(result, p)
+        }
+        report(1)
+        return result, nil
+    }
+    // 2) Work on the histogram; boxes are windows into its bins. Filling it is the
+    // only pass over every pixel, so that is where ctx is checked.
+    h := histogramFor(opts)
+    err := forEachBlock(ctx, len(pixels), report, func(from, to int) {
+        h.AddWeighted(pixels[from:to], sliceWeights(weights, from, to))
+    })
+    if err != nil {
+        return nil, err
+    }
+    return medianCutBins(h.Bins(), k, opts), nil
+}
+
+// medianCutBins runs median cut over histogram bins with the strategies in opts.
+func medianCutBins(bins []histBin, k int, opts MedianCut) []RGB {
+    if k <= 0 || len(bins) == 0 {
+        return nil
+    }
+    if k == 1 && opts.Rep == RepMedian {
+        return []RGB{averageColor(bins, opts.Linear)}
+    }
+    total := 0
+    for _, b := range bins {
+        total += b.N
+    }
+    // 1) Start from a single box and iteratively split the highest-scoring one.
+    boxes := make([]colorBox, 1, k)
+    boxes[0] = colorBox{Bins: bins, Count: total}
+    boxes[0].score = boxScore(boxes[0], opts.Split)
+
+    for len(boxes) < k {
+        // 1.1) Find the box to split (widest channel spread by default).
+        bestIdx := -1
+        bestScore := -1.0
+        for i := range boxes {
+            if boxes[i].score < 0 {
+                continue
+            }
+            if boxes[i].score > bestScore {
+                bestScore = boxes[i].score
+                bestIdx = i
+            }
+        }
+        if bestIdx == -1 {
+            break
+        }
+        // 1.2) Split by median cut along dominant channel.
+        left, right := medianCutSplit(boxes[bestIdx])
+        left.score = boxScore(left, opts.Split)
+        right.score = boxScore(right, opts.Split)
+        // 1.3) Replace original with left, append right.
+        boxes[bestIdx] = left
+        boxes = append(boxes, right)
+    }
+
+    // 2) Reduce each box to a representative color (median per channel by default).
+    palette := make([]RGB, 0, len(boxes))
+    for i := range boxes {
+        palette = append(palette, representative(boxes[i].Bins, opts.Rep, opts.Linear))
+    }
+    return palette
+}
+
+// PadPalette repeats the last color until the palette has k entries. Quantizers
+// return fewer than k colors when the image has fewer distinct ones; padding is
+// only for callers that need a fixed-size palette.
+func PadPalette(palette []RGB, k int) []RGB {
+    if len(palette) == 0 {
+        return palette
+    }
+    for len(palette) < k {
+        palette = append(palette, palette[len(palette)-1])
+    }
+    return palette
+}
+
+// CountOccurrences: single-thread for small inputs; fan-out with goroutines for large.
+func CountOccurrences(pixels []RGB, palette []RGB) []int {
+    return CountOccurrencesMetric(pixels, palette, MetricEuclidean)
+}
+
+// CountOccurrencesMetric assigns each pixel to its nearest palette entry under metric.
+func CountOccurrencesMetric(pixels []RGB, palette []RGB, metric Metric) []int {
+    return CountOccurrencesWeighted(pixels, nil, palette, metric)
+}
+
+// CountOccurrencesWeighted counts alpha-weighted pixels (weights 0..255, nil = uniform);
+// weighted counts are reported in whole-pixel units (sum of alpha / 255).
+func CountOccurrencesWeighted(pixels []RGB, weights []uint8, palette []RGB, metric Metric) []int {
+    if len(palette) == 0 || len(pixels) == 0 {
+        return make([]int, len(palette))
+    }
+    counts := countNearest(nil, pixels, weights, len(palette), metric.nearestFunc(palette))
+    return scaleWeightedCounts(counts, weights)
+}
+
+// countNearest sums weights (or pixels) per nearest index without scaling, so
+// callers can accumulate several batches before scaleWeightedCounts.
+func countNearest(lim *Limiter, pixels []RGB, weights []uint8, n int, nearest func(RGB) int) []int {
+    count := func(from, to int, cnt []int) {
+        if weights == nil {
+            for _, px := range pixels[from:to] {
+                cnt[nearest(px)]++
+            }
+            return
+        }
+        for i := from; i < to; i++ {
+            cnt[nearest(pixels[i])] += int(weights[i])
+        }
+    }
+    // 1) Small inputs: single-thread; large: fan-out by chunks.
+    workers := runtime.GOMAXPROCS(0)
+    if workers < 2 || len(pixels) < 5000 {
+        counts := make([]int, n)
+        count(0, len(pixels), counts)
+        return counts
+    }
+    // 2) Split into roughly equal parts and process in parallel.
+    type part struct{ from, to int }
+    parts := make([]part, 0, workers)
+    step := (len(pixels) + workers - 1) / workers
+    for i := 0; i < len(pixels); i += step {
+        j := i + step
+        if j > len(pixels) {
+            j = len(pixels)
+        }
+        parts = append(parts, part{from: i, to: j})
+    }
+    partials := make([][]int, len(parts))
+    var wg sync.WaitGroup
+    wg.Add(len(parts))
+    for idx, pr := range parts {
+        idx, pr := idx, pr
+        go func() {
+            defer wg.Done()
+            lim.acquire()
+            defer lim.release()
+            cnt := make([]int, n)
+            count(pr.from, pr.to, cnt)
+            partials[idx] = cnt
+        }()
+    }
+    wg.Wait()
+    // 3) Merge partial histograms.
+    counts := make([]int, n)
+    for _, p := range partials {
+        for i := range counts {
+            counts[i] += p[i]
+        }
+    }
+    return counts
+}
+
+// scaleWeightedCounts converts summed alpha back to pixel units.
+func scaleWeightedCounts(counts []int, weights []uint8) []int {
+    if weights == nil {
+        return counts
+    }
+    for i := range counts {
+        counts[i] = (counts[i] + 127) / 255
+    }
+    return counts
+}
+
+// colorDistanceSqInt: int math to avoid float overhead.
+func colorDistanceSqInt(a, b RGB) int {
+    dr := int(a.R) - int(b.R)
+    dg := int(a.G) - int(b.G)
+    db := int(a.B) - int(b.B)
+    return dr*dr + dg*dg + db*db
+}
+
+// PaletteEntry is one swatch with its pixel count and share of the total.
+type PaletteEntry struct {
+    Color  RGB `json:"color"`
+    Count  int `json:"count"`
+    Share  float64 `json:"share"`
+    Hex    string `json:"hex"`
+}
+
+func PrintPaletteText(palette []RGB, counts []int) {
+    WritePalette(os.Stdout, makeEntries(palette, counts), FormatHex)
+}
+
+func PrintPaletteJSON(palette []RGB, counts []int) error {
+    return WritePalette(os.Stdout, makeEntries(palette, counts), FormatJSON)
+}
+
+func makeEntries(palette []RGB, counts []int) []PaletteEntry {
+    total := 0
+    for _, c := range counts {
+        total += c
+    }
+    entries := make([]PaletteEntry, 0, len(palette))
+    for i, c := range palette {
+        share := 0.0
+        if total > 0 {
+            share = float64(counts[i]) / float64(total)
+        }
+        entries = append(entries, PaletteEntry{
+            Color: c,
+            Count: counts[i],
+            Share: share,
+            Hex:   toHex(c),
+        })
+    }
+    sort.Slice(entries, func(i, j int) bool { return entries[i].Count > entries[j].Count })
+    return entries
+}
+
+func toHex(c RGB) string {
+    return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// ParseHex parses "#RRGGBB" (leading # optional), the inverse of toHex.
+func ParseHex(s string) (RGB, error) {
+    var c RGB
+    h := strings.TrimPrefix(s, "#")
+    if len(h) != 6 {
+        return c, fmt.Errorf("color %q: want #RRGGBB", s)
+    }
+    v, err := strconv.ParseUint(h, 16, 32)
+    if err != nil {
+        return c, fmt.Errorf("color %q: %v", s, err)
+    }
+    return RGB{uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+func SavePalettePreview(path string, palette []RGB, counts []int) error {
+    entries := makeEntries(palette, counts)
+    const width = 600
+    const height = 60
+    img := image.NewRGBA(image.Rect(0, 0, width, height))
+    total := 0
+    for _, e := range entries {
+        total += e.Count
+    }
+    if total == 0 {
+        total = 1
+    }
+    x := 0
+    for _, e := range entries {
+        w := int(math.Round(float64(width) * float64(e.Count) / float64(total)))
+        if w <= 0 {
+            continue
+        }
+        fill := color.RGBA{R: e.Color.R, G: e.Color.G, B: e.Color.B, A: 255}
+        for yi := 0; yi < height; yi++ {
+            for xi := x; xi < x+w && xi < width; xi++ {
+                img.SetRGBA(xi, yi, fill)
+            }
+        }
+        x += w
+    }
+
+    f, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    return png.Encode(f, img)
+}
+
+// ComposeWithPaletteStrip returns a new image: original content with a vertical palette strip on the right.
+// The strip shows colors sorted by frequency, stacked vertically with heights proportional to shares.
+func ComposeWithPaletteStrip(src image.Image, palette []RGB, counts []int, stripWidth int) image.Image {
+    if stripWidth <= 0 {
+        stripWidth = 1
+    }
+    entries := makeEntries(palette, counts)
+    b := src.Bounds()
+    w := b.Dx()
+    h := b.Dy()
+    out := image.NewRGBA(image.Rect(0, 0, w+stripWidth, h))
+
+    // 1) Copy source pixels (fast path for RGBA; fallback to At()).
+    if rgba, ok := src.(*image.RGBA); ok && b.Min.X == 0 && b.Min.Y == 0 {
+        for y := 0; y < h; y++ {
+            srcRow := rgba.Pix[y*rgba.Stride : y*rgba.Stride+w*4]
+            dstRow := out.Pix[y*out.Stride : y*out.Stride+w*4]
+            copy(dstRow, srcRow)
+        }
+    } else {
+        for y := 0; y < h; y++ {
+            for x := 0; x < w; x++ {
+                out.Set(x, y, src.At(b.Min.X+x, b.Min.Y+y))
+            }
+        }
+    }
+
+    // 2) Draw vertical palette strip with heights proportional to shares.
+    total := 0
+    for _, e := range entries {
+        total += e.Count
+    }
+    if total == 0 {
+        total = 1
+    }
+    yCursor := 0
+    for i, e := range entries {
+        blockH := int(math.Round(float64(h) * e.Share))
+        if e.Count > 0 && blockH == 0 {
+            blockH = 1
+        }
+        if i == len(entries)-1 {
+            if yCursor+blockH < h {
+                blockH = h - yCursor
+            }
+        }
+        for yy := yCursor; yy < yCursor+blockH && yy < h; yy++ {
+            rowStart := yy * out.Stride
+            for xx := w; xx < w+stripWidth; xx++ {
+                idx := rowStart + xx*4
+                out.Pix[idx] = e.Color.R
+                out.Pix[idx+1] = e.Color.G
+                out.Pix[idx+2] = e.Color.B
+                out.Pix[idx+3] = 255
+            }
+        }
+        yCursor += blockH
+        if yCursor >= h {
+            break
+        }
+    }
+    // 3) Fill any rounding gap with the last color.
+    if yCursor < h && len(entries) > 0 {
+        last := entries[len(entries)-1].Color
+        for yy := yCursor; yy < h; yy++ {
+            rowStart := yy * out.Stride
+            for xx := w; xx < w+stripWidth; xx++ {
+                idx := rowStart + xx*4
+                out.Pix[idx] = last.R
+                out.Pix[idx+1] = last.G
+                out.Pix[idx+2] = last.B
+                out.Pix[idx+3] = 255
+            }
+        }
+    }
+    return out
+}
+
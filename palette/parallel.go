@@ -0,0 +1,53 @@
+package palette
+
+import (
+    "context"
+    "runtime"
+)
+
+// Limiter bounds the fan-out goroutines of the extractions that share it, so
+// several concurrent ones (go-check-color -j) split the CPUs instead of each
+// starting GOMAXPROCS workers. Without one (Options.Limiter nil) an extraction
+// fans out over GOMAXPROCS as read at the time of the call.
+type Limiter struct {
+    slots chan struct{}
+}
+
+// NewLimiter returns a Limiter admitting n workers at once; n <= 0 means the
+// current GOMAXPROCS.
+func NewLimiter(n int) *Limiter {
+    if n <= 0 {
+        n = runtime.GOMAXPROCS(0)
+    }
+    return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// acquire blocks until a worker slot is free; a nil Limiter never blocks.
+func (l *Limiter) acquire() {
+    if l != nil {
+        l.slots <- struct{}{}
+    }
+}
+
+// release returns a slot taken by acquire.
+func (l *Limiter) release() {
+    if l != nil {
+        <-l.slots
+    }
+}
+
+type limiterKey struct{}
+
+// withLimiter carries l down to the fan-outs, which only see ctx.
+func withLimiter(ctx context.Context, l *Limiter) context.Context {
+    if l == nil {
+        return ctx
+    }
+    return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// limiterFrom returns the Limiter stored by withLimiter, or nil.
+func limiterFrom(ctx context.Context) *Limiter {
+    l, _ := ctx.Value(limiterKey{}).(*Limiter)
+    return l
+}
@@ -0,0 +1,119 @@
+package palette
+
+import (
+    "context"
+    "image"
+)
+
+// Phase names a stage of Extract for progress reporting.
+type Phase string
+
+const (
+    PhaseCollect  Phase = "collect"  // reading pixels (and, when banded, filling the histogram)
+    PhaseQuantize Phase = "quantize" // building the palette
+    PhaseCount    Phase = "count"    // assigning pixels to swatches; repeats after merges
+)
+
+// ProgressFunc receives the current phase and its completed fraction in [0, 1].
+// It is called from the goroutine running Extract, never concurrently.
+type ProgressFunc func(phase Phase, fraction float64)
+
+// phase returns a reporter bound to one phase; a nil ProgressFunc reports nothing.
+func (f ProgressFunc) phase(p Phase) func(float64) {
+    if f == nil {
+        return func(float64) {}
+    }
+    return func(fraction float64) { f(p, fraction) }
+}
+
+// forEachBand collects img in full-width row bands of about bandPixels and
+// calls fn per band, top to bottom. It stops with ctx's error once ctx is done.
+func forEachBand(ctx context.Context, img image.Image, alpha AlphaPolicy, exclude []bool, report func(float64), fn func(pixels []RGB, weights []uint8)) error {
+    b := img.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if w == 0 || h == 0 {
+        report(1)
+        return nil
+    }
+    rows := bandPixels / w
+    if rows < 1 {
+        rows = 1
+    }
+    for y := 0; y < h; y += rows {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        y1 := y + rows
+        if y1 > h {
+            y1 = h
+        }
+        band, err := CropImage(img, image.Rect(0, y, w, y1))
+        if err != nil {
+            return err
+        }
+        var bandExclude []bool
+        if exclude != nil {
+            bandExclude = exclude[y*w : y1*w]
+        }
+        fn(CollectPixelsExcluding(band, alpha, bandExclude))
+        report(float64(y1) / float64(h))
+    }
+    return nil
+}
+
+// countBlock: pixels counted between cancellation checks and progress reports.
+const countBlock = 1 << 18
+
+// CountOccurrencesContext is CountOccurrencesWeighted that stops with ctx's error once ctx is done.
+func CountOccurrencesContext(ctx context.Context, pixels []RGB, weights []uint8, palette []RGB, metric Metric) ([]int, error) {
+    return countOccurrencesContext(ctx, pixels, weights, palette, metric, func(float64) {})
+}
+
+func countOccurrencesContext(ctx context.Context, pixels []RGB, weights []uint8, palette []RGB, metric Metric, report func(float64)) ([]int, error) {
+    counts := make([]int, len(palette))
+    if len(palette) == 0 || len(pixels) == 0 {
+        report(1)
+        return counts, nil
+    }
+    nearest := metric.nearestFunc(palette)
+    // Blocks run one after another, each with the usual fan-out inside, so progress
+    // is reported from this goroutine only.
+    err := forEachBlock(ctx, len(pixels), report, func(from, to int) {
+        for i, n := range countNearest(limiterFrom(ctx), pixels[from:to], sliceWeights(weights, from, to), len(palette), nearest) {
+            counts[i] += n
+        }
+    })
+    if err != nil {
+        return nil, err
+    }
+    return scaleWeightedCounts(counts, weights), nil
+}
+
+// forEachBlock calls fn on consecutive countBlock-sized ranges of [0, n), reporting the
+// completed fraction after each. It stops with ctx's error once ctx is done.
+func forEachBlock(ctx context.Context, n int, report func(float64), fn func(from, to int)) error {
+    if n == 0 {
+        report(1)
+        return nil
+    }
+    for from := 0; from < n; from += countBlock {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        to := from + countBlock
+        if to > n {
+            to = n
+        }
+        fn(from, to)
+        report(float64(to) / float64(n))
+    }
+    return nil
+}
+
+// sliceWeights returns weights[from:to], or nil when every pixel counts fully.
+func sliceWeights(weights []uint8, from, to int) []uint8 {
+    if weights == nil {
+        return nil
+    }
+    return weights[from:to]
+}
@@ -0,0 +1,254 @@
+package palette
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "runtime"
+    "strings"
+    "sync"
+)
+
+// Quantizer reduces a set of pixels to a palette of at most k colors.
+type Quantizer interface {
+    Quantize(pixels []RGB, k int) []RGB
+}
+
+// WeightedQuantizer is implemented by quantizers that honour per-pixel weights
+// (alpha, 0..255). A nil weights slice means every pixel counts once.
+type WeightedQuantizer interface {
+    Quantizer
+    QuantizeWeighted(pixels []RGB, weights []uint8, k int) []RGB
+}
+
+// quantizeWeighted uses QuantizeWeighted when weights are present and supported.
+func quantizeWeighted(q Quantizer, pixels []RGB, weights []uint8, k int) []RGB {
+    if wq, ok := q.(WeightedQuantizer); ok && weights != nil {
+        return wq.QuantizeWeighted(pixels, weights, k)
+    }
+    return q.Quantize(pixels, k)
+}
+
+// ContextQuantizer is implemented by quantizers whose runs are long enough to be
+// worth cancelling midway; report receives the completed fraction.
+type ContextQuantizer interface {
+    Quantizer
+    QuantizeContext(ctx context.Context, pixels []RGB, weights []uint8, k int, report func(float64)) ([]RGB, error)
+}
+
+// quantizeContext uses QuantizeContext when available; other quantizers are only
+// checked for cancellation before they start.
+func quantizeContext(ctx context.Context, q Quantizer, pixels []RGB, weights []uint8, k int, report func(float64)) ([]RGB, error) {
+    if cq, ok := q.(ContextQuantizer); ok {
+        return cq.QuantizeContext(ctx, pixels, weights, k, report)
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    palette := quantizeWeighted(q, pixels, weights, k)
+    report(1)
+    return palette, nil
+}
+
+// MedianCut is the default quantizer: recursive median cut over the widest box.
+type MedianCut struct {
+    Linear bool           // average representatives in linear light
+    Split  SplitStrategy  // which box to split next
+    Rep    Representative // how a box becomes a palette color
+}
+
+func (q MedianCut) Quantize(pixels []RGB, k int) []RGB {
+    return q.QuantizeWeighted(pixels, nil, k)
+}
+
+func (q MedianCut) QuantizeWeighted(pixels []RGB, weights []uint8, k int) []RGB {
+    palette, _ := medianCutPalette(context.Background(), pixels, weights, k, q, func(float64) {})
+    return palette
+}
+
+// QuantizeContext checks ctx and reports progress between blocks of the histogram pass.
+func (q MedianCut) QuantizeContext(ctx context.Context, pixels []RGB, weights []uint8, k int, report func(float64)) ([]RGB, error) {
+    return medianCutPalette(ctx, pixels, weights, k, q, report)
+}
+
+// KMeans refines a median-cut palette with Lloyd iterations until assignments stop changing.
+type KMeans struct {
+    MaxIter int  // upper bound on refinement passes; <= 0 means defaultKMeansIter
+    Linear  bool // average seeds and centers in linear light
+}
+
+const defaultKMeansIter = 32
+
+func (q KMeans) Quantize(pixels []RGB, k int) []RGB {
+    return q.QuantizeWeighted(pixels, nil, k)
+}
+
+func (q KMeans) QuantizeWeighted(pixels []RGB, weights []uint8, k int) []RGB {
+    palette, _ := kmeansPalette(context.Background(), pixels, weights, k, q.MaxIter, q.Linear, func(float64) {})
+    return palette
+}
+
+// QuantizeContext checks ctx and reports progress once per Lloyd iteration.
+func (q KMeans) QuantizeContext(ctx context.Context, pixels []RGB, weights []uint8, k int, report func(float64)) ([]RGB, error) {
+    return kmeansPalette(ctx, pixels, weights, k, q.MaxIter, q.Linear, report)
+}
+
+// QuantizerOptions carries settings every quantizer understands, plus the
+// median-cut strategies (ignored by the other algorithms).
+type QuantizerOptions struct {
+    Linear bool // compute representatives in linear light (sRGB decode, average, re-encode)
+    Split  SplitStrategy
+    Rep    Representative
+}
+
+// QuantizerByName maps the -algo flag value to an implementation.
+func QuantizerByName(name string, opts QuantizerOptions) (Quantizer, error) {
+    switch strings.ToLower(name) {
+    case "", "mediancut", "median-cut":
+        return MedianCut{Linear: opts.Linear, Split: opts.Split, Rep: opts.Rep}, nil
+    case "kmeans", "k-means":
+        return KMeans{Linear: opts.Linear}, nil
+    case "octree":
+        return Octree{Linear: opts.Linear}, nil
+    case "wu":
+        return Wu{Linear: opts.Linear}, nil
+    default:
+        return nil, fmt.Errorf("unknown algorithm %q", name)
+    }
+}
+
+// KMeansPalette seeds centers with MedianCutPalette and runs Lloyd's algorithm.
+// Centers are kept as RGB, so identical centers between passes mean identical assignments.
+func KMeansPalette(pixels []RGB, k, maxIter int) []RGB {
+    return KMeansPaletteWeighted(pixels, nil, k, maxIter)
+}
+
+// KMeansPaletteWeighted is KMeansPalette with per-pixel weights (nil = uniform).
+func KMeansPaletteWeighted(pixels []RGB, weights []uint8, k, maxIter int) []RGB {
+    return KMeans{MaxIter: maxIter}.QuantizeWeighted(pixels, weights, k)
+}
+
+func kmeansPalette(ctx context.Context, pixels []RGB, weights []uint8, k, maxIter int, linear bool, report func(float64)) ([]RGB, error) {
+    centers, err := medianCutPalette(ctx, pixels, weights, k, MedianCut{Linear: linear}, func(float64) {})
+    if err != nil {
+        return nil, err
+    }
+    if len(centers) == 0 || len(pixels) <= k {
+        report(1)
+        return centers, nil
+    }
+    if maxIter <= 0 {
+        maxIter = defaultKMeansIter
+    }
+    for iter := 0; iter < maxIter; iter++ {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        report(float64(iter) / float64(maxIter))
+        // 1) Assign pixels to nearest center and accumulate per-cluster sums.
+        sums := kmeansAccumulate(limiterFrom(ctx), pixels, weights, centers)
+        // 2) Move centers to cluster means; empty clusters keep their previous center.
+        changed := false
+        for i := range centers {
+            s := sums[i]
+            if s.n == 0 {
+                continue
+            }
+            n := float64(s.n)
+            c := RGB{
+                uint8(math.Round(float64(s.r) / n)),
+                uint8(math.Round(float64(s.g) / n)),
+                uint8(math.Round(float64(s.b) / n)),
+            }
+            if linear {
+                c = s.lin.mean(s.n)
+            }
+            if c != centers[i] {
+                centers[i] = c
+                changed = true
+            }
+        }
+        // 3) Stable centers imply the next assignment pass would be identical.
+        if !changed {
+            break
+        }
+    }
+    report(1)
+    return centers, nil
+}
+
+type clusterSum struct {
+    r, g, b int64
+    lin     linearSum
+    n       int // total weight
+}
+
+// kmeansAccumulate: same single-thread/fan-out split as CountOccurrences.
+func kmeansAccumulate(lim *Limiter, pixels []RGB, weights []uint8, centers []RGB) []clusterSum {
+    nearest := MetricEuclidean.nearestFunc(centers)
+    accumulate := func(from, to int, sums []clusterSum) {
+        for i := from; i < to; i++ {
+            px := pixels[i]
+            w := int64(1)
+            if weights != nil {
+                w = int64(weights[i])
+            }
+            s := &sums[nearest(px)]
+            s.r += int64(px.R) * w
+            s.g += int64(px.G) * w
+            s.b += int64(px.B) * w
+            s.lin.add(px, int(w))
+            s.n += int(w)
+        }
+    }
+    workers := runtime.GOMAXPROCS(0)
+    if workers < 2 || len(pixels) < 5000 {
+        sums := make([]clusterSum, len(centers))
+        accumulate(0, len(pixels), sums)
+        return sums
+    }
+    step := (len(pixels) + workers - 1) / workers
+    partials := make([][]clusterSum, 0, workers)
+    var wg sync.WaitGroup
+    for i := 0; i < len(pixels); i += step {
+        j := i + step
+        if j > len(pixels) {
+            j = len(pixels)
+        }
+        part := make([]clusterSum, len(centers))
+        partials = append(partials, part)
+        wg.Add(1)
+        go func(from, to int) {
+            defer wg.Done()
+            lim.acquire()
+            defer lim.release()
+            accumulate(from, to, part)
+        }(i, j)
+    }
+    wg.Wait()
+    sums := make([]clusterSum, len(centers))
+    for _, p := range partials {
+        for i := range sums {
+            sums[i].r += p[i].r
+            sums[i].g += p[i].g
+            sums[i].b += p[i].b
+            sums[i].lin.merge(p[i].lin)
+            sums[i].n += p[i].n
+        }
+    }
+    return sums
+}
+
+// nearestIndex: linear scan by squared sRGB distance.
+func nearestIndex(px RGB, palette []RGB) int {
+    bestIdx := 0
+    best := colorDistanceSqInt(px, palette[0])
+    for i := 1; i < len(palette); i++ {
+        d := colorDistanceSqInt(px, palette[i])
+        if d < best {
+            best = d
+            bestIdx = i
+        }
+    }
+    return bestIdx
+}
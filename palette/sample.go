@@ -0,0 +1,141 @@
+package palette
+
+import (
+    "fmt"
+    "image"
+    "math"
+    "strings"
+)
+
+// SampleMode selects how Downsample reduces an image.
+type SampleMode int
+
+const (
+    SampleArea   SampleMode = iota // average every source pixel in the cell
+    SampleStride                   // take the pixel at the cell center
+)
+
+// ParseSampleMode maps the -sample flag value to a SampleMode.
+func ParseSampleMode(name string) (SampleMode, error) {
+    switch strings.ToLower(name) {
+    case "", "area", "box":
+        return SampleArea, nil
+    case "stride", "nearest":
+        return SampleStride, nil
+    default:
+        return SampleArea, fmt.Errorf("unknown sample mode %q", name)
+    }
+}
+
+func (m SampleMode) String() string {
+    if m == SampleStride {
+        return "stride"
+    }
+    return "area"
+}
+
+// sampleSize keeps the aspect ratio and fits w*h within maxPixels.
+func sampleSize(w, h, maxPixels int) (int, int) {
+    scale := math.Sqrt(float64(w) * float64(h) / float64(maxPixels))
+    dw := int(float64(w) / scale)
+    dh := int(float64(h) / scale)
+    if dw < 1 {
+        dw = 1
+    }
+    if dh < 1 {
+        dh = 1
+    }
+    // A side raised to 1 on an extreme aspect ratio overshoots; trim the longer side.
+    // The shorter one is at most sqrt(maxPixels), so the quotient stays >= 1.
+    if dw*dh > maxPixels {
+        if dw >= dh {
+            dw = maxPixels / dh
+        } else {
+            dh = maxPixels / dw
+        }
+    }
+    return dw, dh
+}
+
+// premultipliedAt returns the premultiplied 16-bit color reader for img. The image
+// types CollectPixels special-cases go through their typed accessors, which compute
+// exactly what At(x, y).RGBA() would without boxing a color.Color per pixel.
+func premultipliedAt(img image.Image) func(x, y int) (r, g, b, a uint32) {
+    switch src := img.(type) {
+    case *image.RGBA:
+        return func(x, y int) (r, g, b, a uint32) { return src.RGBAAt(x, y).RGBA() }
+    case *image.NRGBA:
+        return func(x, y int) (r, g, b, a uint32) { return src.NRGBAAt(x, y).RGBA() }
+    case *image.YCbCr:
+        return func(x, y int) (r, g, b, a uint32) { return src.YCbCrAt(x, y).RGBA() }
+    case *image.Gray:
+        return func(x, y int) (r, g, b, a uint32) { return src.GrayAt(x, y).RGBA() }
+    case *image.Gray16:
+        return func(x, y int) (r, g, b, a uint32) { return src.Gray16At(x, y).RGBA() }
+    case *image.RGBA64:
+        return func(x, y int) (r, g, b, a uint32) { return src.RGBA64At(x, y).RGBA() }
+    case *image.NRGBA64:
+        return func(x, y int) (r, g, b, a uint32) { return src.NRGBA64At(x, y).RGBA() }
+    case *image.Paletted:
+        // Resolve each palette index once; indices past the palette read as transparent.
+        var lut [256][4]uint32
+        for j, pc := range src.Palette {
+            if j == len(lut) {
+                break
+            }
+            lut[j][0], lut[j][1], lut[j][2], lut[j][3] = pc.RGBA()
+        }
+        return func(x, y int) (r, g, b, a uint32) {
+            e := &lut[src.ColorIndexAt(x, y)]
+            return e[0], e[1], e[2], e[3]
+        }
+    default:
+        return func(x, y int) (r, g, b, a uint32) { return img.At(x, y).RGBA() }
+    }
+}
+
+// Downsample returns img reduced to at most maxPixels pixels, or img itself when it
+// already fits (or maxPixels <= 0). The grid of cells is fixed by the sizes alone, so
+// the result is deterministic. Output is premultiplied RGBA, which every alpha policy reads.
+func Downsample(img image.Image, maxPixels int, mode SampleMode) image.Image {
+    b := img.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if maxPixels <= 0 || w*h <= maxPixels {
+        return img
+    }
+    dw, dh := sampleSize(w, h, maxPixels)
+    at := premultipliedAt(img)
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+    for y := 0; y < dh; y++ {
+        y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+        for x := 0; x < dw; x++ {
+            x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+            off := dst.PixOffset(x, y)
+            px := dst.Pix[off : off+4 : off+4]
+            if mode == SampleStride {
+                // 1) Stride: the cell's center pixel, unchanged.
+                r, g, bb, a := at((x0+x1)/2, (y0+y1)/2)
+                px[0], px[1], px[2], px[3] = uint8(r>>8), uint8(g>>8), uint8(bb>>8), uint8(a>>8)
+                continue
+            }
+            // 2) Area: mean of the premultiplied 16-bit values over the cell.
+            var sr, sg, sb, sa uint64
+            for sy := y0; sy < y1; sy++ {
+                for sx := x0; sx < x1; sx++ {
+                    r, g, bb, a := at(sx, sy)
+                    sr += uint64(r)
+                    sg += uint64(g)
+                    sb += uint64(bb)
+                    sa += uint64(a)
+                }
+            }
+            n := uint64((x1 - x0) * (y1 - y0))
+            div := n * 257
+            px[0] = uint8((sr + div/2) / div)
+            px[1] = uint8((sg + div/2) / div)
+            px[2] = uint8((sb + div/2) / div)
+            px[3] = uint8((sa + div/2) / div)
+        }
+    }
+    return dst
+}
@@ -0,0 +1,68 @@
+package palette
+
+import (
+    "image"
+    "image/color"
+    "math/rand"
+    "testing"
+)
+
+func TestSampleSizeFits(t *testing.T) {
+    cases := [][3]int{
+        {100000, 1, 10}, {1, 100000, 10}, {100000, 2, 10}, {3, 70000, 7},
+        {6000, 4000, 1 << 20}, {4000, 6000, 12345}, {5, 5, 24}, {1000, 999, 1},
+    }
+    rng := rand.New(rand.NewSource(4))
+    for i := 0; i < 2000; i++ {
+        w, h := 1+rng.Intn(50000), 1+rng.Intn(500)
+        if rng.Intn(2) == 0 {
+            w, h = h, w
+        }
+        cases = append(cases, [3]int{w, h, 1 + rng.Intn(w*h)})
+    }
+    for _, c := range cases {
+        w, h, max := c[0], c[1], c[2]
+        if w*h <= max {
+            continue
+        }
+        dw, dh := sampleSize(w, h, max)
+        if dw < 1 || dh < 1 || dw*dh > max {
+            t.Fatalf("sampleSize(%d, %d, %d) = %dx%d", w, h, max, dw, dh)
+        }
+    }
+}
+
+// opaqueImage hides the concrete type so Downsample takes the At path.
+type opaqueImage struct{ image.Image }
+
+// TestDownsampleTypedMatchesAt checks that the typed readers give the same pixels as At.
+func TestDownsampleTypedMatchesAt(t *testing.T) {
+    rng := rand.New(rand.NewSource(5))
+    r := image.Rect(3, 2, 3+97, 2+61)
+    rgba, nrgba := image.NewRGBA(r), image.NewNRGBA(r)
+    rgba64, nrgba64 := image.NewRGBA64(r), image.NewNRGBA64(r)
+    gray, gray16 := image.NewGray(r), image.NewGray16(r)
+    ycc := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+    pal := image.NewPaletted(r, color.Palette{color.RGBA{255, 0, 0, 255}, color.NRGBA{0, 90, 200, 128}, color.Transparent})
+    rng.Read(rgba.Pix)
+    rng.Read(nrgba.Pix)
+    rng.Read(rgba64.Pix)
+    rng.Read(nrgba64.Pix)
+    rng.Read(gray.Pix)
+    rng.Read(gray16.Pix)
+    rng.Read(ycc.Y)
+    rng.Read(ycc.Cb)
+    rng.Read(ycc.Cr)
+    for i := range pal.Pix {
+        pal.Pix[i] = uint8(rng.Intn(3))
+    }
+    for _, img := range []image.Image{rgba, nrgba, rgba64, nrgba64, gray, gray16, ycc, pal} {
+        for _, mode := range []SampleMode{SampleArea, SampleStride} {
+            got := Downsample(img, 500, mode).(*image.RGBA)
+            want := Downsample(opaqueImage{img}, 500, mode).(*image.RGBA)
+            if string(got.Pix) != string(want.Pix) {
+                t.Errorf("%T %v: typed reader differs from At", img, mode)
+            }
+        }
+    }
+}
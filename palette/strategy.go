@@ -0,0 +1,128 @@
+package palette
+
+import (
+    "fmt"
+    "strings"
+)
+
+// SplitStrategy decides which median-cut box is split next.
+type SplitStrategy int
+
+const (
+    SplitRange           SplitStrategy = iota // widest single-channel range (classic)
+    SplitPopulation                           // most pixels
+    SplitRangePopulation                      // range × pixels
+    SplitVariance                             // largest squared deviation of bin means from the box mean, weighted by population
+)
+
+// Representative decides how a median-cut box is reduced to one color.
+type Representative int
+
+const (
+    RepMedian Representative = iota // per-channel median (classic)
+    RepMean                         // population-weighted mean
+    RepMode                         // most frequent exact color in the box
+)
+
+// ParseSplitStrategy maps the -split flag value to a SplitStrategy.
+func ParseSplitStrategy(name string) (SplitStrategy, error) {
+    switch strings.ToLower(name) {
+    case "", "range":
+        return SplitRange, nil
+    case "population", "count":
+        return SplitPopulation, nil
+    case "range-population", "range*population":
+        return SplitRangePopulation, nil
+    case "variance":
+        return SplitVariance, nil
+    default:
+        return SplitRange, fmt.Errorf("unknown split strategy %q", name)
+    }
+}
+
+// ParseRepresentative maps the -rep flag value to a Representative.
+func ParseRepresentative(name string) (Representative, error) {
+    switch strings.ToLower(name) {
+    case "", "median":
+        return RepMedian, nil
+    case "mean", "average":
+        return RepMean, nil
+    case "mode", "most-frequent":
+        return RepMode, nil
+    default:
+        return RepMedian, fmt.Errorf("unknown representative %q", name)
+    }
+}
+
+// boxScore ranks boxes for splitting; boxes with a single bin cannot be split.
+func boxScore(box colorBox, s SplitStrategy) float64 {
+    if len(box.Bins) <= 1 {
+        return -1
+    }
+    switch s {
+    case SplitPopulation:
+        return float64(box.Count)
+    case SplitRangePopulation:
+        return float64(maxChannelRange(box.Bins)) * float64(box.Count)
+    case SplitVariance:
+        return boxVariance(box.Bins)
+    default:
+        return float64(maxChannelRange(box.Bins))
+    }
+}
+
+func maxChannelRange(bins []histBin) int {
+    r := channelRange(bins, 0)
+    if g := channelRange(bins, 1); g > r {
+        r = g
+    }
+    if b := channelRange(bins, 2); b > r {
+        r = b
+    }
+    return r
+}
+
+// boxVariance: population-weighted squared distance of bin means from the box mean.
+// Spread inside a 5-bit cell is not tracked, so this is the between-cell part only.
+func boxVariance(bins []histBin) float64 {
+    var sr, sg, sb, n float64
+    for _, b := range bins {
+        w := float64(b.N)
+        sr += float64(b.C.R) * w
+        sg += float64(b.C.G) * w
+        sb += float64(b.C.B) * w
+        n += w
+    }
+    if n == 0 {
+        return 0
+    }
+    mr, mg, mb := sr/n, sg/n, sb/n
+    var v float64
+    for _, b := range bins {
+        dr, dg, db := float64(b.C.R)-mr, float64(b.C.G)-mg, float64(b.C.B)-mb
+        v += float64(b.N) * (dr*dr + dg*dg + db*db)
+    }
+    return v
+}
+
+// representative reduces a box to one color.
+func representative(bins []histBin, rep Representative, linear bool) RGB {
+    switch rep {
+    case RepMean:
+        return averageColor(bins, linear)
+    case RepMode:
+        // Every exact color lives in one cell, so the box mode is the top cell mode.
+        best := 0
+        for i := range bins {
+            if bins[i].modeN > bins[best].modeN {
+                best = i
+            }
+        }
+        if len(bins) == 0 {
+            return RGB{0, 0, 0}
+        }
+        return bins[best].mode
+    default:
+        return medianColor(bins, linear)
+    }
+}
@@ -0,0 +1,370 @@
+package palette
+
+import (
+    "context"
+    "math"
+)
+
+// Wu is Xiaolin Wu's greedy orthogonal bipartition quantizer: boxes over a 5-bit
+// moment histogram, always cutting the box with the largest variance where the
+// resulting two halves have minimal summed variance.
+type Wu struct {
+    Linear bool // average box colors in linear light
+}
+
+func (q Wu) Quantize(pixels []RGB, k int) []RGB {
+    return q.QuantizeWeighted(pixels, nil, k)
+}
+
+func (q Wu) QuantizeWeighted(pixels []RGB, weights []uint8, k int) []RGB {
+    palette, _ := wuPalette(context.Background(), pixels, weights, k, q.Linear, func(float64) {})
+    return palette
+}
+
+// QuantizeContext checks ctx and reports progress between blocks of the pixel passes.
+func (q Wu) QuantizeContext(ctx context.Context, pixels []RGB, weights []uint8, k int, report func(float64)) ([]RGB, error) {
+    return wuPalette(ctx, pixels, weights, k, q.Linear, report)
+}
+
+// wuSide: 32 bins per channel plus a zero row for the cumulative moments.
+const wuSide = 33
+
+const (
+    wuRed = iota
+    wuGreen
+    wuBlue
+)
+
+type wuBox struct {
+    r0, r1, g0, g1, b0, b1 int // lower bounds exclusive, upper bounds inclusive
+    vol                    int
+}
+
+type wuMoments struct {
+    wt, mr, mg, mb []int64
+    m2             []float64
+}
+
+func wuIndex(r, g, b int) int {
+    return (r*wuSide+g)*wuSide + b
+}
+
+// WuPalette returns up to k colors; fewer when no box can be split further.
+func WuPalette(pixels []RGB, k int) []RGB {
+    return WuPaletteWeighted(pixels, nil, k)
+}
+
+// WuPaletteWeighted is WuPalette with per-pixel weights (nil = uniform).
+func WuPaletteWeighted(pixels []RGB, weights []uint8, k int) []RGB {
+    palette, _ := wuPalette(context.Background(), pixels, weights, k, false, func(float64) {})
+    return palette
+}
+
+func wuPalette(ctx context.Context, pixels []RGB, weights []uint8, k int, linear bool, report func(float64)) ([]RGB, error) {
+    if k <= 0 || len(pixels) == 0 {
+        report(1)
+        return nil, nil
+    }
+    // Linear means take a second pass over the pixels; each pass reports half.
+    momentsReport, meansReport := report, report
+    if linear {
+        momentsReport = func(f float64) { report(f / 2) }
+        meansReport = func(f float64) { report(0.5 + f/2) }
+    }
+
+    // 1) Histogram and cumulative moments.
+    m := newWuMoments()
+    err := forEachBlock(ctx, len(pixels), momentsReport, func(from, to int) {
+        m.add(pixels[from:to], sliceWeights(weights, from, to))
+    })
+    if err != nil {
+        return nil, err
+    }
+    m.cumulate()
+
+    // 2) Split the box with the largest variance until k boxes exist.
+    cubes := make([]wuBox, k)
+    vv := make([]float64, k)
+    cubes[0] = wuBox{r1: wuSide - 1, g1: wuSide - 1, b1: wuSide - 1}
+    n := k
+    next := 0
+    for i := 1; i < k; i++ {
+        if m.cut(&cubes[next], &cubes[i]) {
+            vv[next], vv[i] = 0, 0
+            if cubes[next].vol > 1 {
+                vv[next] = m.variance(&cubes[next])
+            }
+            if cubes[i].vol > 1 {
+                vv[i] = m.variance(&cubes[i])
+            }
+        } else {
+            vv[next] = 0
+            i--
+        }
+        next = 0
+        best := vv[0]
+        for j := 1; j <= i; j++ {
+            if vv[j] > best {
+                best = vv[j]
+                next = j
+            }
+        }
+        if best <= 0 {
+            n = i + 1
+            break
+        }
+    }
+
+    // 3) Each box is represented by its mean color.
+    if linear {
+        return wuLinearMeans(ctx, pixels, weights, cubes[:n], meansReport)
+    }
+    palette := make([]RGB, 0, n)
+    for i := 0; i < n; i++ {
+        c := &cubes[i]
+        w := float64(wuVolume(c, m.wt))
+        if w == 0 {
+            continue
+        }
+        palette = append(palette, RGB{
+            uint8(math.Round(float64(wuVolume(c, m.mr)) / w)),
+            uint8(math.Round(float64(wuVolume(c, m.mg)) / w)),
+            uint8(math.Round(float64(wuVolume(c, m.mb)) / w)),
+        })
+    }
+    return palette, nil
+}
+
+// wuLinearMeans averages each box in linear light. The moments only hold gamma-encoded
+// sums, so pixels are tagged with their box through the 5-bit cell grid and summed again.
+func wuLinearMeans(ctx context.Context, pixels []RGB, weights []uint8, cubes []wuBox, report func(float64)) ([]RGB, error) {
+    const cells = wuSide - 1
+    tag := make([]int16, cells*cells*cells)
+    for i := range tag {
+        tag[i] = -1
+    }
+    for i, c := range cubes {
+        for r := c.r0 + 1; r <= c.r1; r++ {
+            for g := c.g0 + 1; g <= c.g1; g++ {
+                for b := c.b0 + 1; b <= c.b1; b++ {
+                    tag[((r-1)*cells+g-1)*cells+b-1] = int16(i)
+                }
+            }
+        }
+    }
+    sums := make([]linearSum, len(cubes))
+    counts := make([]int, len(cubes))
+    err := forEachBlock(ctx, len(pixels), report, func(from, to int) {
+        for i := from; i < to; i++ {
+            w := 1
+            if weights != nil {
+                w = int(weights[i])
+            }
+            p := pixels[i]
+            box := tag[(int(p.R>>3)*cells+int(p.G>>3))*cells+int(p.B>>3)]
+            sums[box].add(p, w)
+            counts[box] += w
+        }
+    })
+    if err != nil {
+        return nil, err
+    }
+    palette := make([]RGB, 0, len(cubes))
+    for i := range cubes {
+        if counts[i] > 0 {
+            palette = append(palette, sums[i].mean(counts[i]))
+        }
+    }
+    return palette, nil
+}
+
+func newWuMoments() *wuMoments {
+    size := wuSide * wuSide * wuSide
+    return &wuMoments{
+        wt: make([]int64, size),
+        mr: make([]int64, size),
+        mg: make([]int64, size),
+        mb: make([]int64, size),
+        m2: make([]float64, size),
+    }
+}
+
+// add accumulates pixels into the per-bin moments.
+func (m *wuMoments) add(pixels []RGB, weights []uint8) {
+    for i, p := range pixels {
+        w := int64(1)
+        if weights != nil {
+            w = int64(weights[i])
+        }
+        idx := wuIndex(int(p.R>>3)+1, int(p.G>>3)+1, int(p.B>>3)+1)
+        r, g, b := int64(p.R), int64(p.G), int64(p.B)
+        m.wt[idx] += w
+        m.mr[idx] += r * w
+        m.mg[idx] += g * w
+        m.mb[idx] += b * w
+        m.m2[idx] += float64((r*r + g*g + b*b) * w)
+    }
+}
+
+// cumulate turns per-bin moments into 3D prefix sums so any box is O(1) to evaluate.
+func (m *wuMoments) cumulate() {
+    var area, areaR, areaG, areaB [wuSide]int64
+    var area2 [wuSide]float64
+    for r := 1; r < wuSide; r++ {
+        for i := range area {
+            area[i], areaR[i], areaG[i], areaB[i], area2[i] = 0, 0, 0, 0, 0
+        }
+        for g := 1; g < wuSide; g++ {
+            var line, lineR, lineG, lineB int64
+            var line2 float64
+            for b := 1; b < wuSide; b++ {
+                idx := wuIndex(r, g, b)
+                line += m.wt[idx]
+                lineR += m.mr[idx]
+                lineG += m.mg[idx]
+                lineB += m.mb[idx]
+                line2 += m.m2[idx]
+                area[b] += line
+                areaR[b] += lineR
+                areaG[b] += lineG
+                areaB[b] += lineB
+                area2[b] += line2
+                prev := wuIndex(r-1, g, b)
+                m.wt[idx] = m.wt[prev] + area[b]
+                m.mr[idx] = m.mr[prev] + areaR[b]
+                m.mg[idx] = m.mg[prev] + areaG[b]
+                m.mb[idx] = m.mb[prev] + areaB[b]
+                m.m2[idx] = m.m2[prev] + area2[b]
+            }
+        }
+    }
+}
+
+func wuVolume(c *wuBox, mt []int64) int64 {
+    return mt[wuIndex(c.r1, c.g1, c.b1)] -
+        mt[wuIndex(c.r1, c.g1, c.b0)] -
+        mt[wuIndex(c.r1, c.g0, c.b1)] +
+        mt[wuIndex(c.r1, c.g0, c.b0)] -
+        mt[wuIndex(c.r0, c.g1, c.b1)] +
+        mt[wuIndex(c.r0, c.g1, c.b0)] +
+        mt[wuIndex(c.r0, c.g0, c.b1)] -
+        mt[wuIndex(c.r0, c.g0, c.b0)]
+}
+
+// wuBottom: part of the volume that does not depend on the cut position along dir.
+func wuBottom(c *wuBox, dir int, mt []int64) int64 {
+    switch dir {
+    case wuRed:
+        return -mt[wuIndex(c.r0, c.g1, c.b1)] +
+            mt[wuIndex(c.r0, c.g1, c.b0)] +
+            mt[wuIndex(c.r0, c.g0, c.b1)] -
+            mt[wuIndex(c.r0, c.g0, c.b0)]
+    case wuGreen:
+        return -mt[wuIndex(c.r1, c.g0, c.b1)] +
+            mt[wuIndex(c.r1, c.g0, c.b0)] +
+            mt[wuIndex(c.r0, c.g0, c.b1)] -
+            mt[wuIndex(c.r0, c.g0, c.b0)]
+    default:
+        return -mt[wuIndex(c.r1, c.g1, c.b0)] +
+            mt[wuIndex(c.r1, c.g0, c.b0)] +
+            mt[wuIndex(c.r0, c.g1, c.b0)] -
+            mt[wuIndex(c.r0, c.g0, c.b0)]
+    }
+}
+
+// wuTop: remainder of the volume for a cut at pos along dir.
+func wuTop(c *wuBox, dir, pos int, mt []int64) int64 {
+    switch dir {
+    case wuRed:
+        return mt[wuIndex(pos, c.g1, c.b1)] -
+            mt[wuIndex(pos, c.g1, c.b0)] -
+            mt[wuIndex(pos, c.g0, c.b1)] +
+            mt[wuIndex(pos, c.g0, c.b0)]
+    case wuGreen:
+        return mt[wuIndex(c.r1, pos, c.b1)] -
+            mt[wuIndex(c.r1, pos, c.b0)] -
+            mt[wuIndex(c.r0, pos, c.b1)] +
+            mt[wuIndex(c.r0, pos, c.b0)]
+    default:
+        return mt[wuIndex(c.r1, c.g1, pos)] -
+            mt[wuIndex(c.r1, c.g0, pos)] -
+            mt[wuIndex(c.r0, c.g1, pos)] +
+            mt[wuIndex(c.r0, c.g0, pos)]
+    }
+}
+
+// variance: weighted sum of squared deviations from the box mean.
+func (m *wuMoments) variance(c *wuBox) float64 {
+    dr := float64(wuVolume(c, m.mr))
+    dg := float64(wuVolume(c, m.mg))
+    db := float64(wuVolume(c, m.mb))
+    xx := m.m2[wuIndex(c.r1, c.g1, c.b1)] -
+        m.m2[wuIndex(c.r1, c.g1, c.b0)] -
+        m.m2[wuIndex(c.r1, c.g0, c.b1)] +
+        m.m2[wuIndex(c.r1, c.g0, c.b0)] -
+        m.m2[wuIndex(c.r0, c.g1, c.b1)] +
+        m.m2[wuIndex(c.r0, c.g1, c.b0)] +
+        m.m2[wuIndex(c.r0, c.g0, c.b1)] -
+        m.m2[wuIndex(c.r0, c.g0, c.b0)]
+    return xx - (dr*dr+dg*dg+db*db)/float64(wuVolume(c, m.wt))
+}
+
+// maximize finds the cut along dir that maximizes the between-halves term
+// (equivalently minimizes the summed variance); returns the score and position, -1 if none.
+func (m *wuMoments) maximize(c *wuBox, dir, first, last int, wholeR, wholeG, wholeB, wholeW float64) (float64, int) {
+    // Moments are squared below; go through float64 so large images cannot overflow int64.
+    baseR := float64(wuBottom(c, dir, m.mr))
+    baseG := float64(wuBottom(c, dir, m.mg))
+    baseB := float64(wuBottom(c, dir, m.mb))
+    baseW := float64(wuBottom(c, dir, m.wt))
+    best, cut := 0.0, -1
+    for i := first; i < last; i++ {
+        halfR := baseR + float64(wuTop(c, dir, i, m.mr))
+        halfG := baseG + float64(wuTop(c, dir, i, m.mg))
+        halfB := baseB + float64(wuTop(c, dir, i, m.mb))
+        halfW := baseW + float64(wuTop(c, dir, i, m.wt))
+        if halfW == 0 {
+            continue
+        }
+        score := (halfR*halfR + halfG*halfG + halfB*halfB) / halfW
+        halfR, halfG, halfB, halfW = wholeR-halfR, wholeG-halfG, wholeB-halfB, wholeW-halfW
+        if halfW == 0 {
+            continue
+        }
+        score += (halfR*halfR + halfG*halfG + halfB*halfB) / halfW
+        if score > best {
+            best, cut = score, i
+        }
+    }
+    return best, cut
+}
+
+// cut splits a into a and b along the best axis; false when a cannot be split.
+func (m *wuMoments) cut(a, b *wuBox) bool {
+    wholeR := float64(wuVolume(a, m.mr))
+    wholeG := float64(wuVolume(a, m.mg))
+    wholeB := float64(wuVolume(a, m.mb))
+    wholeW := float64(wuVolume(a, m.wt))
+    maxR, cutR := m.maximize(a, wuRed, a.r0+1, a.r1, wholeR, wholeG, wholeB, wholeW)
+    maxG, cutG := m.maximize(a, wuGreen, a.g0+1, a.g1, wholeR, wholeG, wholeB, wholeW)
+    maxB, cutB := m.maximize(a, wuBlue, a.b0+1, a.b1, wholeR, wholeG, wholeB, wholeW)
+
+    b.r1, b.g1, b.b1 = a.r1, a.g1, a.b1
+    switch {
+    case maxR >= maxG && maxR >= maxB:
+        if cutR < 0 {
+            return false
+        }
+        a.r1 = cutR
+        b.r0, b.g0, b.b0 = cutR, a.g0, a.b0
+    case maxG >= maxR && maxG >= maxB:
+        a.g1 = cutG
+        b.r0, b.g0, b.b0 = a.r0, cutG, a.b0
+    default:
+        a.b1 = cutB
+        b.r0, b.g0, b.b0 = a.r0, a.g0, cutB
+    }
+    a.vol = (a.r1 - a.r0) * (a.g1 - a.g0) * (a.b1 - a.b0)
+    b.vol = (b.r1 - b.r0) * (b.g1 - b.g0) * (b.b1 - b.b0)
+    return true
+}